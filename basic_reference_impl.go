@@ -2,20 +2,136 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// Program is a parsed BASIC program, independent of any run of it, so one
+// parse can be listed, validated and executed any number of times.
+type Program struct {
+	Lines       map[int]string // statement text by line number
+	LineNumbers []int          // sorted
+	Labels      map[string]int // line number of each "name:" label
+}
+
 type BasicInterpreter struct {
-	program        map[int]string
+	program        *Program
 	variables      map[string]interface{}
 	programCounter int
-	lineNumbers    []int
+	jumped         bool // the last statement moved programCounter
 	forStack       []ForLoop
-	output         []string
+	output         *screenBuffer
+	line           string // source text of the line being executed
+	hasError       bool   // errorLine and errorColumn describe the last error
+	errorLine      int
+	errorColumn    int // offset of the failing token in the line, -1 if unknown
+	lastError      error
+	immediate      bool
+	trace          bool
+	traceWriter    io.Writer
+
+	// MaxForDepth is how many FOR loops may be active at once; a FOR
+	// beyond it is a runtime error. Zero means unlimited.
+	MaxForDepth int
+
+	// FloatDivision makes / always yield a float. It is off by default,
+	// so an exact quotient such as 10 / 2 collapses to the integer 2.
+	FloatDivision bool
+
+	// FixedDecimals prints every number with that many decimal places when
+	// greater than zero; ThousandsSeparator groups integer digits with
+	// commas. Both are off by default.
+	FixedDecimals      int
+	ThousandsSeparator bool
+
+	// OutputCapacity preallocates room for this many output lines when a
+	// program is loaded, avoiding regrowth for output-heavy programs.
+	OutputCapacity int
+
+	// Strict turns constructs that classic BASIC tolerates but that usually
+	// indicate a bug, such as starting a FOR on a variable whose loop is
+	// still active, into errors.
+	Strict bool
+}
+
+// screenBuffer holds the lines currently on screen; CLS clears it
+type screenBuffer struct {
+	lines []string
+}
+
+func newScreenBuffer(capacity int) *screenBuffer {
+	return &screenBuffer{lines: make([]string, 0, capacity)}
+}
+
+func (sb *screenBuffer) writeLine(line string) {
+	sb.lines = append(sb.lines, line)
+}
+
+func (sb *screenBuffer) clear() {
+	sb.lines = make([]string, 0, cap(sb.lines))
+}
+
+type ErrorKind string
+
+const (
+	KindSyntax        ErrorKind = "syntax"
+	KindRuntime       ErrorKind = "runtime"
+	KindUndefinedLine ErrorKind = "undefined-line"
+)
+
+// BasicError is returned by Execute and Run for any failure while running
+// a program, so embedding code can branch on Kind instead of parsing text.
+type BasicError struct {
+	Line      int
+	Statement string
+	Kind      ErrorKind
+	Err       error
+}
+
+// NoLine is BasicError.Line for a parse error on a source line without a
+// usable line number
+const NoLine = -1
+
+func (e *BasicError) Error() string {
+	if e.Line == NoLine {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("error at line %d: %v", e.Line, e.Err)
+}
+
+func (e *BasicError) Unwrap() error {
+	return e.Err
+}
+
+func newBasicError(lineNum int, statement string, err error) *BasicError {
+	kind := KindRuntime
+	var ke *kindError
+	if errors.As(err, &ke) {
+		kind = ke.kind
+	}
+	return &BasicError{Line: lineNum, Statement: statement, Kind: kind, Err: err}
+}
+
+// kindError tags an error raised inside a statement with its ErrorKind;
+// untagged errors are runtime errors.
+type kindError struct {
+	kind ErrorKind
+	msg  string
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func newKindError(kind ErrorKind, format string, args ...interface{}) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
 }
 
 type ForLoop struct {
@@ -27,72 +143,275 @@ type ForLoop struct {
 
 func NewBasicInterpreter() *BasicInterpreter {
 	return &BasicInterpreter{
-		program:   make(map[int]string),
-		variables: make(map[string]interface{}),
-		forStack:  make([]ForLoop, 0),
-		output:    make([]string, 0),
+		program:     newProgram(),
+		variables:   make(map[string]interface{}),
+		forStack:    make([]ForLoop, 0),
+		output:      newScreenBuffer(0),
+		traceWriter: os.Stderr,
+		MaxForDepth: 1000,
 	}
 }
 
-func (bi *BasicInterpreter) LoadProgram(programText string) error {
-	bi.program = make(map[int]string)
+func (bi *BasicInterpreter) SetTrace(enabled bool) {
+	bi.trace = enabled
+}
+
+func (bi *BasicInterpreter) SetTraceWriter(w io.Writer) {
+	bi.traceWriter = w
+}
+
+// Reset clears runtime state (variables, loop stack, output and program
+// counter) but keeps the loaded program, so it can be executed again from
+// a clean slate.
+func (bi *BasicInterpreter) Reset() {
 	bi.variables = make(map[string]interface{})
 	bi.forStack = make([]ForLoop, 0)
-	bi.output = make([]string, 0)
+	bi.output = newScreenBuffer(bi.OutputCapacity)
+	bi.programCounter = 0
+	bi.hasError = false
+	bi.errorLine = 0
+	bi.errorColumn = -1
+	bi.lastError = nil
+}
 
-	lines := strings.Split(strings.TrimSpace(programText), "\n")
-	for _, line := range lines {
+func newProgram() *Program {
+	return &Program{
+		Lines:  make(map[int]string),
+		Labels: make(map[string]int),
+	}
+}
+
+// Parse splits program text into numbered lines and collects its labels.
+// Statements themselves are not checked until they run or Validate is
+// called. Errors are *BasicError values of KindSyntax.
+func Parse(programText string) (*Program, error) {
+	program := newProgram()
+
+	lines := strings.Split(programText, "\n")
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
+		sourceLine := i + 1
 
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
+		// The space after the line number is optional, as in 10PRINT
+		digits := 0
+		for digits < len(line) && line[digits] >= '0' && line[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 {
 			continue
 		}
+		statement := strings.TrimSpace(line[digits:])
 
-		lineNum, err := strconv.Atoi(parts[0])
+		lineNum, err := strconv.Atoi(line[:digits])
 		if err != nil {
-			continue
+			// All digits, so the only possible failure is overflow
+			return nil, parseError(NoLine, line, "source line %d: line number %s is out of range", sourceLine, line[:digits])
+		}
+		if statement == "" {
+			return nil, parseError(lineNum, line, "no statement after the line number")
+		}
+
+		program.Lines[lineNum] = statement
+
+		if label, _ := splitLabel(statement); label != "" {
+			if existing, exists := program.Labels[label]; exists {
+				return nil, parseError(lineNum, statement, "duplicate label %s at lines %d and %d", label, existing, lineNum)
+			}
+			program.Labels[label] = lineNum
 		}
+	}
 
-		bi.program[lineNum] = parts[1]
+	program.LineNumbers = make([]int, 0, len(program.Lines))
+	for lineNum := range program.Lines {
+		program.LineNumbers = append(program.LineNumbers, lineNum)
 	}
+	sort.Ints(program.LineNumbers)
+
+	return program, nil
+}
+
+// parseError reports a problem found by Parse
+func parseError(lineNum int, statement, format string, args ...interface{}) *BasicError {
+	return newBasicError(lineNum, statement, newKindError(KindSyntax, format, args...))
+}
 
-	bi.lineNumbers = make([]int, 0, len(bi.program))
-	for lineNum := range bi.program {
-		bi.lineNumbers = append(bi.lineNumbers, lineNum)
+// ListRange lists the lines numbered from to to inclusive; a negative to
+// means through the end
+func (p *Program) ListRange(from, to int) string {
+	var sb strings.Builder
+	for _, lineNum := range p.LineNumbers {
+		if lineNum < from || (to >= 0 && lineNum > to) {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%d %s\n", lineNum, p.Lines[lineNum]))
 	}
-	sort.Ints(bi.lineNumbers)
+	return sb.String()
+}
 
+func (bi *BasicInterpreter) LoadProgram(programText string) error {
+	program, err := Parse(programText)
+	if err != nil {
+		return err
+	}
+	bi.Load(program)
 	return nil
 }
 
+// Load makes program the one Execute runs, clearing the runtime state. The
+// program is not modified, so it may be shared between interpreters.
+func (bi *BasicInterpreter) Load(program *Program) {
+	bi.program = program
+	bi.Reset()
+}
+
+var statementKeywords = []string{
+	"PRINT", "LET", "GOTO", "IF", "FOR", "NEXT", "INPUT",
+	"CLS", "TRON", "TROFF", "REM", "END", "STOP",
+}
+
+// splitLabel separates a leading "name:" label from the rest of a statement
+func splitLabel(statement string) (string, string) {
+	colon := strings.Index(statement, ":")
+	if colon <= 0 || !isLabelName(statement[:colon]) {
+		return "", statement
+	}
+	// A keyword is not a label, but a name merely starting with one, such
+	// as ENDLOOP, is
+	for _, keyword := range statementKeywords {
+		if statement[:colon] == keyword {
+			return "", statement
+		}
+	}
+	return statement[:colon], strings.TrimSpace(statement[colon+1:])
+}
+
+func isLabelName(name string) bool {
+	for i, char := range name {
+		isLetter := (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || char == '_'
+		if !isLetter && (i == 0 || char < '0' || char > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func (bi *BasicInterpreter) List() string {
+	return bi.ListRange(0, -1)
+}
+
+func (bi *BasicInterpreter) ListRange(from, to int) string {
+	return bi.program.ListRange(from, to)
+}
+
+// Validate checks the loaded program for syntax problems without running
+// anything, reporting every problem found rather than just the first.
+func (bi *BasicInterpreter) Validate() []*BasicError {
+	problems := make([]*BasicError, 0)
+	for _, lineNum := range bi.program.LineNumbers {
+		_, statement := splitLabel(bi.program.Lines[lineNum])
+		if err := bi.validateStatement(statement, 0); err != nil {
+			problems = append(problems, newBasicError(lineNum, bi.program.Lines[lineNum], err))
+		}
+	}
+	return problems
+}
+
+func (bi *BasicInterpreter) validateStatement(statement string, col int) error {
+	statement, col = trimAt(statement, col)
+
+	if strings.Count(statement, "\"")%2 != 0 {
+		return newKindError(KindSyntax, "unbalanced quotes")
+	}
+
+	if statement == "" || strings.HasPrefix(statement, "REM") {
+		return nil
+	} else if strings.HasPrefix(statement, "IF") {
+		_, _, thenPart, thenCol, err := splitIf(statement, col)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range bi.splitStatements(thenPart, thenCol) {
+			if err := bi.validateStatement(stmt.text, stmt.col); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if strings.HasPrefix(statement, "FOR") {
+		_, err := parseFor(statement, col)
+		return err
+	} else if strings.HasPrefix(statement, "LET") {
+		if !strings.Contains(statement, "=") {
+			return newKindError(KindSyntax, "invalid LET syntax")
+		}
+		return nil
+	} else if strings.HasPrefix(statement, "GOTO") {
+		_, err := bi.resolveGoto(statement, col)
+		return err
+	}
+
+	for _, keyword := range statementKeywords {
+		if strings.HasPrefix(statement, keyword) {
+			return nil
+		}
+	}
+	return newKindError(KindSyntax, "syntax error: unknown command '%s'", statement)
+}
+
 func (bi *BasicInterpreter) Run(programText string) error {
 	if err := bi.LoadProgram(programText); err != nil {
+		bi.lastError = err
 		return err
 	}
 	return bi.Execute()
 }
 
+// RunProgram loads an already parsed program and executes it
+func (bi *BasicInterpreter) RunProgram(program *Program) error {
+	bi.Load(program)
+	return bi.Execute()
+}
+
+// LastError returns the error from the most recent Run or Execute, or nil
+// if it succeeded. Runtime failures are *BasicError values.
+func (bi *BasicInterpreter) LastError() error {
+	return bi.lastError
+}
+
 func (bi *BasicInterpreter) Execute() error {
-	if len(bi.lineNumbers) == 0 {
+	if len(bi.program.LineNumbers) == 0 {
 		return nil
 	}
 
 	bi.programCounter = 0
+	bi.hasError = false
+	bi.errorLine = 0
+	bi.lastError = nil
+
+	for bi.programCounter < len(bi.program.LineNumbers) {
+		lineNum := bi.program.LineNumbers[bi.programCounter]
+		bi.line = bi.program.Lines[lineNum]
+		_, statement := splitLabel(bi.line)
+		// The statement is the end of the line, after any label
+		col := len(bi.line) - len(statement)
+
+		if bi.trace {
+			fmt.Fprintf(bi.traceWriter, "[%d]\n", lineNum)
+		}
 
-	for bi.programCounter < len(bi.lineNumbers) {
-		lineNum := bi.lineNumbers[bi.programCounter]
-		statement := bi.program[lineNum]
-
-		shouldContinue, err := bi.executeStatement(statement)
+		bi.errorColumn = -1
+		shouldContinue, err := bi.executeStatement(statement, col)
 		if err != nil {
-			return fmt.Errorf("error at line %d: %v", lineNum, err)
+			bi.hasError = true
+			bi.errorLine = lineNum
+			bi.lastError = newBasicError(lineNum, statement, err)
+			return bi.lastError
 		}
 
 		if !shouldContinue {
+			bi.forStack = bi.forStack[:0]
 			break
 		}
 
@@ -102,46 +421,90 @@ func (bi *BasicInterpreter) Execute() error {
 	return nil
 }
 
-func (bi *BasicInterpreter) executeStatement(statement string) (bool, error) {
-	statement = strings.TrimSpace(statement)
+// ExecuteLine runs an unnumbered statement, or several separated by colons,
+// immediately against the current variables and output. Statements that
+// need a running program (GOTO, FOR, NEXT) are rejected.
+func (bi *BasicInterpreter) ExecuteLine(statement string) error {
+	bi.immediate = true
+	defer func() { bi.immediate = false }()
 
-	if strings.HasPrefix(statement, "PRINT") {
-		return true, bi.executePrint(statement)
+	for _, stmt := range bi.splitStatements(statement, 0) {
+		shouldContinue, err := bi.executeStatement(stmt.text, stmt.col)
+		if err != nil {
+			return err
+		}
+		if !shouldContinue {
+			break
+		}
+	}
+	return nil
+}
+
+var programOnlyKeywords = []string{"GOTO", "FOR", "NEXT"}
+
+// executeStatement runs one statement. col, here and in the functions it
+// calls, is where the text starts in the line being executed, so an error
+// can be located in it.
+func (bi *BasicInterpreter) executeStatement(statement string, col int) (bool, error) {
+	statement, col = trimAt(statement, col)
+
+	if bi.immediate {
+		for _, keyword := range programOnlyKeywords {
+			if strings.HasPrefix(statement, keyword) {
+				return false, newKindError(KindSyntax, "%s is not allowed in immediate mode", keyword)
+			}
+		}
+	}
+
+	if statement == "" {
+		return true, nil // Label-only line
+	} else if strings.HasPrefix(statement, "PRINT") {
+		return true, bi.executePrint(statement, col)
 	} else if strings.HasPrefix(statement, "LET") {
-		return true, bi.executeLet(statement)
+		return true, bi.executeLet(statement, col)
 	} else if strings.HasPrefix(statement, "GOTO") {
-		return true, bi.executeGoto(statement)
+		return true, bi.executeGoto(statement, col)
 	} else if strings.HasPrefix(statement, "IF") {
-		return true, bi.executeIf(statement)
+		return bi.executeIf(statement, col)
 	} else if strings.HasPrefix(statement, "FOR") {
-		return true, bi.executeFor(statement)
+		return true, bi.executeFor(statement, col)
 	} else if strings.HasPrefix(statement, "NEXT") {
 		return true, bi.executeNext(statement)
 	} else if strings.HasPrefix(statement, "INPUT") {
-		return true, bi.executeInput(statement)
+		return true, bi.executeInput(statement, col)
+	} else if strings.HasPrefix(statement, "CLS") {
+		bi.output.clear()
+		return true, nil
+	} else if strings.HasPrefix(statement, "TRON") {
+		bi.trace = true
+		return true, nil
+	} else if strings.HasPrefix(statement, "TROFF") {
+		bi.trace = false
+		return true, nil
 	} else if strings.HasPrefix(statement, "REM") {
 		return true, nil // Comment
-	} else if strings.HasPrefix(statement, "END") {
+	} else if strings.HasPrefix(statement, "END") || strings.HasPrefix(statement, "STOP") {
 		return false, nil
 	} else {
-		return false, fmt.Errorf("syntax error: unknown command '%s'", statement)
+		bi.noteErrorColumn(col)
+		return false, newKindError(KindSyntax, "syntax error: unknown command '%s'", statement)
 	}
 }
 
-func (bi *BasicInterpreter) executePrint(statement string) error {
-	expr := strings.TrimSpace(statement[5:])
+func (bi *BasicInterpreter) executePrint(statement string, col int) error {
+	expr, exprCol := trimAt(statement[5:], col+5)
 
 	if expr == "" {
-		bi.output = append(bi.output, "")
+		bi.output.writeLine("")
 		fmt.Println()
 		return nil
 	}
 
-	parts := bi.parsePrintParts(expr)
+	parts := bi.parsePrintParts(expr, exprCol)
 	outputParts := make([]string, 0)
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
+	for _, piece := range parts {
+		part := piece.text
 		if part == ";" {
 			continue
 		}
@@ -149,107 +512,160 @@ func (bi *BasicInterpreter) executePrint(statement string) error {
 		if strings.HasPrefix(part, "\"") && strings.HasSuffix(part, "\"") {
 			outputParts = append(outputParts, part[1:len(part)-1])
 		} else {
-			result, err := bi.evaluateExpression(part)
+			result, err := bi.evaluateExpression(part, piece.col)
 			if err != nil {
-				return fmt.Errorf("error evaluating expression '%s': %v", part, err)
+				return fmt.Errorf("error evaluating expression '%s': %w", part, err)
 			}
 			outputParts = append(outputParts, bi.formatValue(result))
 		}
 	}
 
 	output := strings.Join(outputParts, " ")
-	bi.output = append(bi.output, output)
+	bi.output.writeLine(output)
 	fmt.Println(output)
 	return nil
 }
 
-func (bi *BasicInterpreter) executeLet(statement string) error {
-	expr := strings.TrimSpace(statement[3:])
-	parts := strings.SplitN(expr, "=", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid LET syntax")
+func (bi *BasicInterpreter) executeLet(statement string, col int) error {
+	expr, exprCol := trimAt(statement[3:], col+3)
+	equals := strings.Index(expr, "=")
+	if equals < 0 {
+		return newKindError(KindSyntax, "invalid LET syntax")
 	}
 
-	varName := strings.TrimSpace(parts[0])
-	valueExpr := strings.TrimSpace(parts[1])
+	varName, varCol := trimAt(expr[:equals], exprCol)
+	value, err := bi.evaluateExpression(expr[equals+1:], exprCol+equals+1)
+	if err != nil {
+		return err
+	}
 
-	value, err := bi.evaluateExpression(valueExpr)
+	return bi.assignVariable(varName, varCol, value)
+}
+
+func (bi *BasicInterpreter) executeGoto(statement string, col int) error {
+	index, err := bi.resolveGoto(statement, col)
 	if err != nil {
 		return err
 	}
 
-	bi.variables[varName] = value
+	bi.programCounter = index - 1
+	bi.jumped = true
 	return nil
 }
 
-func (bi *BasicInterpreter) executeGoto(statement string) error {
-	lineNumStr := strings.TrimSpace(statement[4:])
+// resolveGoto returns the index into lineNumbers of a GOTO's target line
+func (bi *BasicInterpreter) resolveGoto(statement string, col int) (int, error) {
+	lineNumStr, targetCol := trimAt(statement[4:], col+4)
 	targetLine, err := strconv.Atoi(lineNumStr)
 	if err != nil {
-		return fmt.Errorf("invalid GOTO syntax")
+		if !isLabelName(lineNumStr) {
+			return 0, newKindError(KindSyntax, "invalid GOTO syntax")
+		}
+		labelLine, exists := bi.program.Labels[lineNumStr]
+		if !exists {
+			bi.noteErrorColumn(targetCol)
+			return 0, newKindError(KindUndefinedLine, "undefined label %s in GOTO statement", lineNumStr)
+		}
+		targetLine = labelLine
 	}
 
-	for i, lineNum := range bi.lineNumbers {
+	for i, lineNum := range bi.program.LineNumbers {
 		if lineNum == targetLine {
-			bi.programCounter = i - 1
-			return nil
+			return i, nil
 		}
 	}
 
-	return fmt.Errorf("undefined line number %d in GOTO statement", targetLine)
+	bi.noteErrorColumn(targetCol)
+	return 0, newKindError(KindUndefinedLine, "undefined line number %d in GOTO statement", targetLine)
 }
 
-func (bi *BasicInterpreter) executeIf(statement string) error {
-	expr := strings.TrimSpace(statement[2:])
+// splitIf returns the condition and THEN clause of an IF statement, with
+// their columns
+func splitIf(statement string, col int) (condition string, conditionCol int, thenPart string, thenCol int, err error) {
+	expr, exprCol := trimAt(statement[2:], col+2)
 	parts := strings.Split(expr, " THEN ")
 	if len(parts) != 2 {
-		return fmt.Errorf("invalid IF syntax")
+		return "", 0, "", 0, newKindError(KindSyntax, "invalid IF syntax")
 	}
+	condition, conditionCol = trimAt(parts[0], exprCol)
+	thenPart, thenCol = trimAt(parts[1], exprCol+len(parts[0])+len(" THEN "))
+	return condition, conditionCol, thenPart, thenCol, nil
+}
 
-	condition := strings.TrimSpace(parts[0])
-	thenPart := strings.TrimSpace(parts[1])
+func (bi *BasicInterpreter) executeIf(statement string, col int) (bool, error) {
+	condition, conditionCol, thenPart, thenCol, err := splitIf(statement, col)
+	if err != nil {
+		return false, err
+	}
 
-	conditionResult, err := bi.evaluateCondition(condition)
+	conditionResult, err := bi.evaluateCondition(condition, conditionCol)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if conditionResult {
-		_, err := bi.executeStatement(thenPart)
-		return err
+		// A jump ends the THEN clause; the rest of it is skipped
+		for _, stmt := range bi.splitStatements(thenPart, thenCol) {
+			bi.jumped = false
+			shouldContinue, err := bi.executeStatement(stmt.text, stmt.col)
+			if err != nil || !shouldContinue || bi.jumped {
+				return shouldContinue, err
+			}
+		}
 	}
 
-	return nil
+	return true, nil
 }
 
-func (bi *BasicInterpreter) executeFor(statement string) error {
-	expr := strings.TrimSpace(statement[3:])
-	parts := strings.Fields(expr)
-	if len(parts) < 5 || parts[1] != "=" || parts[3] != "TO" {
-		return fmt.Errorf("invalid FOR syntax")
+func parseFor(statement string, col int) ([]sourcePiece, error) {
+	parts := fieldsAt(statement[3:], col+3)
+	if len(parts) < 5 || parts[1].text != "=" || parts[3].text != "TO" {
+		return nil, newKindError(KindSyntax, "invalid FOR syntax")
+	}
+	return parts, nil
+}
+
+func (bi *BasicInterpreter) executeFor(statement string, col int) error {
+	parts, err := parseFor(statement, col)
+	if err != nil {
+		return err
 	}
 
-	varName := parts[0]
-	startValue, err := bi.evaluateExpression(parts[2])
+	varName := parts[0].text
+	startValue, err := bi.evaluateExpression(parts[2].text, parts[2].col)
 	if err != nil {
 		return err
 	}
-	endValue, err := bi.evaluateExpression(parts[4])
+	endValue, err := bi.evaluateExpression(parts[4].text, parts[4].col)
 	if err != nil {
 		return err
 	}
 
 	stepValue := 1.0
-	if len(parts) >= 7 && parts[5] == "STEP" {
-		step, err := bi.evaluateExpression(parts[6])
+	if len(parts) >= 7 && parts[5].text == "STEP" {
+		step, err := bi.evaluateExpression(parts[6].text, parts[6].col)
 		if err != nil {
 			return err
 		}
 		stepValue = bi.toFloat(step)
 	}
 
-	bi.variables[varName] = startValue
-	currentLine := bi.lineNumbers[bi.programCounter]
+	if bi.Strict {
+		for _, loop := range bi.forStack {
+			if loop.variable == varName {
+				return fmt.Errorf("FOR %s started while the FOR %s at line %d is still active (missing NEXT %s?)", varName, varName, loop.line, varName)
+			}
+		}
+	}
+
+	if bi.MaxForDepth > 0 && len(bi.forStack) >= bi.MaxForDepth {
+		return newKindError(KindRuntime, "FOR nesting too deep")
+	}
+	if err := bi.assignVariable(varName, parts[0].col, startValue); err != nil {
+		return err
+	}
+
+	currentLine := bi.program.LineNumbers[bi.programCounter]
 	bi.forStack = append(bi.forStack, ForLoop{
 		variable: varName,
 		end:      bi.toFloat(endValue),
@@ -278,13 +694,16 @@ func (bi *BasicInterpreter) executeNext(statement string) error {
 
 	currentValue := bi.toFloat(bi.variables[loopInfo.variable])
 	newValue := currentValue + loopInfo.step
-	bi.variables[loopInfo.variable] = newValue
+	if err := bi.assignVariable(loopInfo.variable, -1, newValue); err != nil {
+		return err
+	}
 
 	if (loopInfo.step > 0 && newValue <= loopInfo.end) ||
 		(loopInfo.step < 0 && newValue >= loopInfo.end) {
-		for i, lineNum := range bi.lineNumbers {
+		for i, lineNum := range bi.program.LineNumbers {
 			if lineNum == loopInfo.line {
 				bi.programCounter = i
+				bi.jumped = true
 				break
 			}
 		}
@@ -295,23 +714,21 @@ func (bi *BasicInterpreter) executeNext(statement string) error {
 	return nil
 }
 
-func (bi *BasicInterpreter) executeInput(statement string) error {
-	expr := strings.TrimSpace(statement[5:])
+func (bi *BasicInterpreter) executeInput(statement string, col int) error {
+	expr, exprCol := trimAt(statement[5:], col+5)
 
 	var prompt string
-	var varName string
+	varName, varCol := expr, exprCol
 
-	if strings.Contains(expr, ";") {
-		parts := strings.SplitN(expr, ";", 2)
-		prompt = strings.TrimSpace(parts[0])
-		varName = strings.TrimSpace(parts[1])
+	if semicolon := strings.Index(expr, ";"); semicolon >= 0 {
+		prompt = strings.TrimSpace(expr[:semicolon])
+		varName, varCol = trimAt(expr[semicolon+1:], exprCol+semicolon+1)
 
 		if strings.HasPrefix(prompt, "\"") && strings.HasSuffix(prompt, "\"") {
 			prompt = prompt[1 : len(prompt)-1]
 			fmt.Print(prompt)
 		}
 	} else {
-		varName = expr
 		fmt.Print("? ")
 	}
 
@@ -322,21 +739,45 @@ func (bi *BasicInterpreter) executeInput(statement string) error {
 	}
 	input = strings.TrimSpace(input)
 
+	if strings.HasSuffix(varName, "$") {
+		return bi.assignVariable(varName, varCol, input)
+	}
+
 	if value, err := strconv.ParseFloat(input, 64); err == nil {
 		if value == float64(int(value)) {
-			bi.variables[varName] = int(value)
-		} else {
-			bi.variables[varName] = value
+			return bi.assignVariable(varName, varCol, int(value))
+		}
+		return bi.assignVariable(varName, varCol, value)
+	}
+	return bi.assignVariable(varName, varCol, input)
+}
+
+// assignVariable stores a value, enforcing the type implied by the
+// variable's suffix: $ holds strings and % holds integers. col is where the
+// name appears in the line, or -1 if it does not.
+func (bi *BasicInterpreter) assignVariable(varName string, col int, value interface{}) error {
+	if strings.HasSuffix(varName, "$") {
+		if _, ok := value.(string); !ok {
+			bi.noteErrorColumn(col)
+			return fmt.Errorf("type mismatch: cannot assign number to string variable %s", varName)
+		}
+	} else if strings.HasSuffix(varName, "%") {
+		switch v := value.(type) {
+		case int:
+		case float64:
+			value = int(v)
+		default:
+			bi.noteErrorColumn(col)
+			return fmt.Errorf("type mismatch: cannot assign string to integer variable %s", varName)
 		}
-	} else {
-		bi.variables[varName] = input
 	}
 
+	bi.variables[varName] = value
 	return nil
 }
 
-func (bi *BasicInterpreter) evaluateExpression(expr string) (interface{}, error) {
-	expr = strings.TrimSpace(expr)
+func (bi *BasicInterpreter) evaluateExpression(expr string, col int) (interface{}, error) {
+	expr, col = trimAt(expr, col)
 
 	if strings.HasPrefix(expr, "\"") && strings.HasSuffix(expr, "\"") {
 		return expr[1 : len(expr)-1], nil
@@ -353,21 +794,21 @@ func (bi *BasicInterpreter) evaluateExpression(expr string) (interface{}, error)
 		return value, nil
 	}
 
-	return bi.evaluateArithmetic(expr)
+	return bi.evaluateArithmetic(expr, col)
 }
 
-func (bi *BasicInterpreter) evaluateArithmetic(expr string) (interface{}, error) {
-	expr = strings.TrimSpace(expr)
+func (bi *BasicInterpreter) evaluateArithmetic(expr string, col int) (interface{}, error) {
+	expr, col = trimAt(expr, col)
 
 	// Handle addition and subtraction
 	for i := len(expr) - 1; i >= 0; i-- {
 		if expr[i] == '+' || expr[i] == '-' {
 			if i > 0 && !strings.ContainsAny(string(expr[i-1]), "*/+-(<>=") {
-				left, err := bi.evaluateExpression(expr[:i])
+				left, err := bi.evaluateExpression(expr[:i], col)
 				if err != nil {
 					return nil, err
 				}
-				right, err := bi.evaluateExpression(expr[i+1:])
+				right, err := bi.evaluateExpression(expr[i+1:], col+i+1)
 				if err != nil {
 					return nil, err
 				}
@@ -376,17 +817,9 @@ func (bi *BasicInterpreter) evaluateArithmetic(expr string) (interface{}, error)
 				rightFloat := bi.toFloat(right)
 
 				if expr[i] == '+' {
-					result := leftFloat + rightFloat
-					if result == float64(int(result)) {
-						return int(result), nil
-					}
-					return result, nil
+					return bi.numericResult(col+i, leftFloat+rightFloat)
 				} else {
-					result := leftFloat - rightFloat
-					if result == float64(int(result)) {
-						return int(result), nil
-					}
-					return result, nil
+					return bi.numericResult(col+i, leftFloat-rightFloat)
 				}
 			}
 		}
@@ -395,11 +828,11 @@ func (bi *BasicInterpreter) evaluateArithmetic(expr string) (interface{}, error)
 	// Handle multiplication and division
 	for i := len(expr) - 1; i >= 0; i-- {
 		if expr[i] == '*' || expr[i] == '/' {
-			left, err := bi.evaluateExpression(expr[:i])
+			left, err := bi.evaluateExpression(expr[:i], col)
 			if err != nil {
 				return nil, err
 			}
-			right, err := bi.evaluateExpression(expr[i+1:])
+			right, err := bi.evaluateExpression(expr[i+1:], col+i+1)
 			if err != nil {
 				return nil, err
 			}
@@ -408,20 +841,22 @@ func (bi *BasicInterpreter) evaluateArithmetic(expr string) (interface{}, error)
 			rightFloat := bi.toFloat(right)
 
 			if expr[i] == '*' {
-				result := leftFloat * rightFloat
-				if result == float64(int(result)) {
-					return int(result), nil
-				}
-				return result, nil
+				return bi.numericResult(col+i, leftFloat*rightFloat)
 			} else {
 				if rightFloat == 0 {
+					_, divisorCol := trimAt(expr[i+1:], col+i+1)
+					bi.noteErrorColumn(divisorCol)
 					return nil, fmt.Errorf("division by zero")
 				}
 				result := leftFloat / rightFloat
-				if result == float64(int(result)) {
-					return int(result), nil
+				if bi.FloatDivision {
+					if err := checkOverflow(result); err != nil {
+						bi.noteErrorColumn(col + i)
+						return nil, err
+					}
+					return result, nil
 				}
-				return result, nil
+				return bi.numericResult(col+i, result)
 			}
 		}
 	}
@@ -437,22 +872,43 @@ func (bi *BasicInterpreter) evaluateArithmetic(expr string) (interface{}, error)
 		return value, nil
 	}
 
+	bi.noteErrorColumn(col)
 	return nil, fmt.Errorf("cannot evaluate expression: %s", expr)
 }
 
-func (bi *BasicInterpreter) evaluateCondition(condition string) (bool, error) {
-	condition = strings.TrimSpace(condition)
+// numericResult rejects overflowed values, blaming the operator at column
+// opCol, and narrows whole results to int
+func (bi *BasicInterpreter) numericResult(opCol int, result float64) (interface{}, error) {
+	if err := checkOverflow(result); err != nil {
+		bi.noteErrorColumn(opCol)
+		return nil, err
+	}
+	if result == float64(int(result)) {
+		return int(result), nil
+	}
+	return result, nil
+}
+
+func checkOverflow(value float64) error {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return fmt.Errorf("numeric overflow")
+	}
+	return nil
+}
+
+func (bi *BasicInterpreter) evaluateCondition(condition string, col int) (bool, error) {
+	condition, col = trimAt(condition, col)
 
 	operators := []string{">", "<", "="}
 	for _, op := range operators {
 		if strings.Contains(condition, op) {
 			parts := strings.SplitN(condition, op, 2)
 			if len(parts) == 2 {
-				left, err := bi.evaluateExpression(strings.TrimSpace(parts[0]))
+				left, err := bi.evaluateExpression(parts[0], col)
 				if err != nil {
 					return false, err
 				}
-				right, err := bi.evaluateExpression(strings.TrimSpace(parts[1]))
+				right, err := bi.evaluateExpression(parts[1], col+len(parts[0])+len(op))
 				if err != nil {
 					return false, err
 				}
@@ -475,30 +931,63 @@ func (bi *BasicInterpreter) evaluateCondition(condition string) (bool, error) {
 	return false, nil
 }
 
-func (bi *BasicInterpreter) parsePrintParts(expr string) []string {
-	parts := make([]string, 0)
-	currentPart := ""
-	inQuotes := false
+func (bi *BasicInterpreter) parsePrintParts(expr string, col int) []sourcePiece {
+	return splitOutsideQuotes(expr, col, ';')
+}
+
+func (bi *BasicInterpreter) splitStatements(text string, col int) []sourcePiece {
+	return splitOutsideQuotes(text, col, ':')
+}
+
+// sourcePiece is part of the line being executed and the column it starts at
+type sourcePiece struct {
+	text string
+	col  int
+}
+
+// trimAt trims spaces from s, which starts at column col, returning the
+// column where the trimmed text starts
+func trimAt(s string, col int) (string, int) {
+	trimmed := strings.TrimLeftFunc(s, unicode.IsSpace)
+	return strings.TrimRightFunc(trimmed, unicode.IsSpace), col + len(s) - len(trimmed)
+}
 
-	for _, char := range expr {
-		if char == '"' {
+// splitOutsideQuotes splits text, which starts at column col, at each sep
+// not inside a string literal, trimming the pieces and dropping empty ones
+func splitOutsideQuotes(text string, col int, sep byte) []sourcePiece {
+	pieces := make([]sourcePiece, 0)
+	start := 0
+	inQuotes := false
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && text[i] == '"' {
 			inQuotes = !inQuotes
-			currentPart += string(char)
-		} else if char == ';' && !inQuotes {
-			if strings.TrimSpace(currentPart) != "" {
-				parts = append(parts, strings.TrimSpace(currentPart))
+		}
+		if i == len(text) || (text[i] == sep && !inQuotes) {
+			if piece, pieceCol := trimAt(text[start:i], col+start); piece != "" {
+				pieces = append(pieces, sourcePiece{piece, pieceCol})
 			}
-			currentPart = ""
-		} else {
-			currentPart += string(char)
+			start = i + 1
 		}
 	}
+	return pieces
+}
 
-	if strings.TrimSpace(currentPart) != "" {
-		parts = append(parts, strings.TrimSpace(currentPart))
+// fieldsAt splits text, which starts at column col, into space-separated
+// fields, as strings.Fields does
+func fieldsAt(text string, col int) []sourcePiece {
+	var fields []sourcePiece
+	start := -1
+	for i, char := range text + " " {
+		if unicode.IsSpace(char) {
+			if start >= 0 {
+				fields = append(fields, sourcePiece{text[start:i], col + start})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
 	}
-
-	return parts
+	return fields
 }
 
 func (bi *BasicInterpreter) toFloat(value interface{}) float64 {
@@ -520,12 +1009,12 @@ func (bi *BasicInterpreter) toFloat(value interface{}) float64 {
 func (bi *BasicInterpreter) formatValue(value interface{}) string {
 	switch v := value.(type) {
 	case int:
-		return strconv.Itoa(v)
-	case float64:
-		if v == float64(int(v)) {
-			return strconv.Itoa(int(v))
+		if bi.FixedDecimals > 0 {
+			return bi.formatNumber(float64(v))
 		}
-		return strconv.FormatFloat(v, 'g', -1, 64)
+		return bi.groupThousands(strconv.Itoa(v))
+	case float64:
+		return bi.formatNumber(v)
 	case string:
 		return v
 	default:
@@ -533,26 +1022,122 @@ func (bi *BasicInterpreter) formatValue(value interface{}) string {
 	}
 }
 
+// noteErrorColumn records col as where the innermost piece of source text
+// that failed starts, so ErrorContext can point at it. The innermost piece
+// reports first, so later calls on the way out are ignored.
+func (bi *BasicInterpreter) noteErrorColumn(col int) {
+	if bi.errorColumn < 0 {
+		bi.errorColumn = col
+	}
+}
+
+func (bi *BasicInterpreter) ErrorContext() string {
+	if !bi.hasError {
+		return ""
+	}
+	return renderErrorContext(bi.errorLine, bi.program.Lines[bi.errorLine], bi.errorColumn)
+}
+
+// renderErrorContext shows the line with a caret under column, or under
+// its start if column is negative
+func renderErrorContext(lineNum int, statement string, column int) string {
+	prefix := fmt.Sprintf("%d ", lineNum)
+	if column < 0 {
+		column = 0
+	}
+	return fmt.Sprintf("  %s%s\n  %s^\n", prefix, statement, strings.Repeat(" ", len(prefix)+column))
+}
+
+func (bi *BasicInterpreter) formatNumber(v float64) string {
+	var text string
+	if bi.FixedDecimals > 0 {
+		text = strconv.FormatFloat(v, 'f', bi.FixedDecimals, 64)
+	} else if v == math.Trunc(v) && math.Abs(v) < 1e21 {
+		// Whole numbers print as plain integers rather than 1e+06
+		text = strconv.FormatFloat(v, 'f', 0, 64)
+	} else {
+		text = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return bi.groupThousands(text)
+}
+
+func (bi *BasicInterpreter) groupThousands(text string) string {
+	if !bi.ThousandsSeparator || strings.ContainsAny(text, "eE") {
+		return text
+	}
+
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+	intPart, fracPart := text, ""
+	if dot := strings.Index(text, "."); dot >= 0 {
+		intPart, fracPart = text[:dot], text[dot:]
+	}
+
+	var sb strings.Builder
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(digit)
+	}
+	return sign + sb.String() + fracPart
+}
+
 func (bi *BasicInterpreter) GetOutput() []string {
-	return bi.output
+	return bi.output.lines
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <program.bas>\n", os.Args[0])
-		os.Exit(1)
+func (bi *BasicInterpreter) GetVariable(name string) (interface{}, bool) {
+	value, exists := bi.variables[name]
+	return value, exists
+}
+
+// SetVariable seeds a variable from the host program. Call it after
+// LoadProgram, which clears all variables, and before Execute. The value
+// must suit the name's type suffix, as for LET.
+func (bi *BasicInterpreter) SetVariable(name string, v interface{}) error {
+	switch n := v.(type) {
+	case int32:
+		v = int(n)
+	case int64:
+		v = int(n)
+	case float32:
+		v = float64(n)
 	}
+	return bi.assignVariable(name, -1, v)
+}
 
-	filename := os.Args[1]
-	programBytes, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filename, err)
+func main() {
+	var programText string
+
+	if len(os.Args) >= 2 {
+		filename := os.Args[1]
+		var programBytes []byte
+		var err error
+		if filename == "-" {
+			programBytes, err = io.ReadAll(os.Stdin)
+		} else {
+			programBytes, err = os.ReadFile(filename)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", filename, err)
+			os.Exit(1)
+		}
+		programText = string(programBytes)
+	} else if envProgram := os.Getenv("BASIC_PROGRAM"); envProgram != "" {
+		programText = envProgram
+	} else {
+		fmt.Fprintf(os.Stderr, "Usage: %s <program.bas>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Use - to read the program from stdin, or set BASIC_PROGRAM with no argument\n")
 		os.Exit(1)
 	}
 
 	interpreter := NewBasicInterpreter()
-	if err := interpreter.Run(string(programBytes)); err != nil {
+	if err := interpreter.Run(programText); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprint(os.Stderr, interpreter.ErrorContext())
 		os.Exit(1)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,756 @@
+package main
+
+// Run with go test basic_reference_impl.go basic_reference_impl_test.go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListSortsLines(t *testing.T) {
+	bi := NewBasicInterpreter()
+	if err := bi.LoadProgram("30 END\n10 PRINT \"A\"\n20 GOTO 30"); err != nil {
+		t.Fatal(err)
+	}
+	want := "10 PRINT \"A\"\n20 GOTO 30\n30 END\n"
+	if got := bi.List(); got != want {
+		t.Errorf("List() = %q, want %q", got, want)
+	}
+	if got := bi.ListRange(15, 25); got != "20 GOTO 30\n" {
+		t.Errorf("ListRange(15, 25) = %q", got)
+	}
+}
+
+func TestThenClauseIsConditional(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	err := bi.Run(`10 LET A = 0
+20 IF A > 0 THEN PRINT "X" : PRINT "Y"
+30 PRINT "DONE"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); len(got) != 1 || got[0] != "DONE" {
+		t.Errorf("output %q, want only DONE", got)
+	}
+}
+
+func TestThenClauseRunsEveryStatement(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	if err := bi.Run(`10 IF 1 > 0 THEN PRINT "X" : PRINT "Y"`); err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); len(got) != 2 || got[0] != "X" || got[1] != "Y" {
+		t.Errorf("output %q, want X and Y", got)
+	}
+}
+
+func TestThenClauseStopsAfterGoto(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	err := bi.Run(`10 IF 1 > 0 THEN GOTO 30 : PRINT "SKIPPED"
+20 PRINT "NOT REACHED"
+30 PRINT "TARGET"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); len(got) != 1 || got[0] != "TARGET" {
+		t.Errorf("output %q, want only TARGET", got)
+	}
+}
+
+func TestEndInsideLoopHalts(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	err := bi.Run(`10 FOR I = 1 TO 5
+20 PRINT I
+30 IF I = 2 THEN END : PRINT "AFTER END"
+40 NEXT I
+50 PRINT "AFTER LOOP"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("output %q, want 1 and 2", got)
+	}
+	if len(bi.forStack) != 0 {
+		t.Errorf("%d FOR loops still active after END", len(bi.forStack))
+	}
+}
+
+// caretUnder checks that context shows source and puts its caret under the
+// character at offset in source
+func caretUnder(t *testing.T, context, source string, offset int) {
+	t.Helper()
+	lines := strings.Split(context, "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], source) {
+		t.Fatalf("error context %q does not show %q", context, source)
+	}
+	want := len(lines[0]) - len(source) + offset
+	if got := strings.Index(lines[1], "^"); got != want {
+		t.Errorf("caret at column %d, want %d:\n%s", got, want, context)
+	}
+}
+
+func TestErrorContextPointsAtBadToken(t *testing.T) {
+	quietStdout(t)
+	for _, test := range []struct {
+		program, source, token string
+	}{
+		{"10 PRINT 1 + X", "10 PRINT 1 + X", "X"},
+		// The divisor is the second "0" on the line, not the quoted one
+		{`10 PRINT "0"; 1 / 0`, `10 PRINT "0"; 1 / 0`, "0"},
+		{"0 PRINT 1 / 0", "0 PRINT 1 / 0", "0"},
+		{"10 PRINT 1E200 * 1E200", "10 PRINT 1E200 * 1E200", "*"},
+		{"10 START:  PRINT 2 + Y", "10 START:  PRINT 2 + Y", "Y"},
+		{"10 IF  1 < Q THEN PRINT 1", "10 IF  1 < Q THEN PRINT 1", "Q"},
+		{"10 IF 1 < 2 THEN PRINT 1 : PRINT 3 / 0", "10 IF 1 < 2 THEN PRINT 1 : PRINT 3 / 0", "0"},
+		{"10 FOR I = 1 TO  Z", "10 FOR I = 1 TO  Z", "Z"},
+		{`10 LET  A$ = 5`, `10 LET  A$ = 5`, "A$"},
+		{"10 GOTO   90", "10 GOTO   90", "90"},
+	} {
+		bi := NewBasicInterpreter()
+		if err := bi.Run(test.program); err == nil {
+			t.Errorf("%s: no error", test.program)
+			continue
+		}
+		caretUnder(t, bi.ErrorContext(), test.source, strings.LastIndex(test.source, test.token))
+	}
+}
+
+func TestErrorContextEmptyWithoutError(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	if err := bi.Run(`10 PRINT "OK"`); err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.ErrorContext(); got != "" {
+		t.Errorf("ErrorContext() = %q after a clean run", got)
+	}
+}
+
+func TestStringVariableTypeMismatch(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	err := bi.Run("10 LET A$ = 5")
+	if err == nil || !strings.Contains(err.Error(), "type mismatch") {
+		t.Fatalf("got %v, want a type mismatch", err)
+	}
+	if _, exists := bi.GetVariable("A$"); exists {
+		t.Error("A$ was assigned despite the mismatch")
+	}
+}
+
+func TestIntegerVariableTruncates(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	if err := bi.Run("10 LET A% = 7 / 2\n20 PRINT A%"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := bi.GetVariable("A%"); value != 3 {
+		t.Errorf("A%% = %v (%T), want int 3", value, value)
+	}
+	if got := bi.GetOutput(); len(got) != 1 || got[0] != "3" {
+		t.Errorf("output %q, want 3", got)
+	}
+	if err := bi.Run(`10 LET A% = "X"`); err == nil {
+		t.Error("assigning a string to A% succeeded")
+	}
+}
+
+func TestTraceFollowsGoto(t *testing.T) {
+	quietStdout(t)
+	var trace bytes.Buffer
+	bi := NewBasicInterpreter()
+	bi.SetTraceWriter(&trace)
+	err := bi.Run(`10 TRON
+20 GOTO 40
+30 PRINT "SKIPPED"
+40 PRINT "HERE"
+50 TROFF
+60 PRINT "UNTRACED"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TRON takes effect from the next line, and TROFF's own line is traced
+	if want := "[20]\n[40]\n[50]\n"; trace.String() != want {
+		t.Errorf("trace %q, want %q", trace.String(), want)
+	}
+	if got := bi.GetOutput(); len(got) != 2 {
+		t.Errorf("trace lines leaked into the output: %q", got)
+	}
+}
+
+func TestForNestingLimit(t *testing.T) {
+	quietStdout(t)
+	program := `10 FOR I = 1 TO 2
+20 FOR J = 1 TO 2
+30 FOR K = 1 TO 2
+40 NEXT K
+50 NEXT J
+60 NEXT I`
+
+	bi := NewBasicInterpreter()
+	bi.MaxForDepth = 2
+	err := bi.Run(program)
+	var basicErr *BasicError
+	if !errors.As(err, &basicErr) || basicErr.Line != 30 || basicErr.Kind != KindRuntime || !strings.Contains(err.Error(), "FOR nesting too deep") {
+		t.Fatalf("got %v, want FOR nesting too deep at line 30", err)
+	}
+	if _, exists := bi.GetVariable("K"); exists {
+		t.Error("the rejected FOR assigned its loop variable")
+	}
+
+	bi.MaxForDepth = 3
+	if err := bi.Run(program); err != nil {
+		t.Errorf("with room for three loops: %v", err)
+	}
+}
+
+// runMain runs the interpreter's main in a child process with args, the
+// extra environment variables env and stdin, returning its combined output
+func runMain(t *testing.T, stdin string, env []string, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainHelper$")
+	cmd.Env = append(os.Environ(), "BASIC_TEST_MAIN=1", "BASIC_TEST_ARGS="+strings.Join(args, "\n"))
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// TestMainHelper is not a real test: runMain runs it as the interpreter
+func TestMainHelper(t *testing.T) {
+	if os.Getenv("BASIC_TEST_MAIN") != "1" {
+		return
+	}
+	os.Args = []string{"basic"}
+	if args := os.Getenv("BASIC_TEST_ARGS"); args != "" {
+		os.Args = append(os.Args, strings.Split(args, "\n")...)
+	}
+	main()
+	os.Exit(0)
+}
+
+func TestMainReadsEnvironmentProgram(t *testing.T) {
+	output, err := runMain(t, "", []string{`BASIC_PROGRAM=10 PRINT "FROM ENV"`})
+	if err != nil || output != "FROM ENV\n" {
+		t.Errorf("got %q (%v), want FROM ENV", output, err)
+	}
+}
+
+func TestMainReadsStdin(t *testing.T) {
+	output, err := runMain(t, `10 PRINT "FROM STDIN"`, []string{`BASIC_PROGRAM=10 PRINT "FROM ENV"`}, "-")
+	if err != nil || output != "FROM STDIN\n" {
+		t.Errorf("got %q (%v), want FROM STDIN", output, err)
+	}
+}
+
+func TestMainWithoutProgram(t *testing.T) {
+	output, err := runMain(t, "", []string{"BASIC_PROGRAM="})
+	if err == nil || !strings.Contains(output, "Usage:") {
+		t.Errorf("got %q (%v), want a usage error", output, err)
+	}
+}
+
+func TestMainRunsFileArgument(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.bas")
+	bad := filepath.Join(dir, "bad.bas")
+	if err := os.WriteFile(good, []byte("10 PRINT \"FROM FILE\"\n20 PRINT 1+1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte("10 PRINT \"BEFORE\"\n20 GOTO 99\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{`BASIC_PROGRAM=10 PRINT "FROM ENV"`}
+
+	output, err := runMain(t, "", env, good)
+	if err != nil || output != "FROM FILE\n2\n" {
+		t.Errorf("got %q (%v), want the file's output", output, err)
+	}
+
+	output, err = runMain(t, "", env, bad)
+	if err == nil || !strings.HasPrefix(output, "BEFORE\n") || !strings.Contains(output, "99") {
+		t.Errorf("got %q (%v), want a failure naming the missing line", output, err)
+	}
+
+	output, err = runMain(t, "", env, filepath.Join(dir, "missing.bas"))
+	if err == nil || !strings.Contains(output, "missing.bas") {
+		t.Errorf("got %q (%v), want an error naming the missing file", output, err)
+	}
+}
+
+func TestDivisionModes(t *testing.T) {
+	quietStdout(t)
+	for _, test := range []struct {
+		floatDivision bool
+		want          []string
+		wantType      string
+	}{
+		{false, []string{"5", "2.5"}, "int"},
+		{true, []string{"5", "2.5"}, "float64"},
+	} {
+		bi := NewBasicInterpreter()
+		bi.FloatDivision = test.floatDivision
+		if err := bi.Run("10 LET A = 10 / 2\n20 PRINT A\n30 PRINT 10 / 4"); err != nil {
+			t.Fatal(err)
+		}
+		got := bi.GetOutput()
+		if len(got) != 2 || got[0] != test.want[0] || got[1] != test.want[1] {
+			t.Errorf("FloatDivision %v: output %q, want %q", test.floatDivision, got, test.want)
+		}
+		// An exact quotient stays a float in float mode, though it prints
+		// as a whole number
+		if value, _ := bi.GetVariable("A"); fmt.Sprintf("%T", value) != test.wantType {
+			t.Errorf("FloatDivision %v: 10 / 2 is %T, want %s", test.floatDivision, value, test.wantType)
+		}
+	}
+}
+
+// printed runs program on bi and returns its output
+func printed(t *testing.T, bi *BasicInterpreter, program string) []string {
+	t.Helper()
+	if err := bi.Run(program); err != nil {
+		t.Fatalf("%s: %v", program, err)
+	}
+	return bi.GetOutput()
+}
+
+func TestNumberFormatting(t *testing.T) {
+	quietStdout(t)
+	program := "10 PRINT 1000000\n20 PRINT 500000 * 2\n30 PRINT 1234.5\n40 PRINT 2 / 8"
+
+	bi := NewBasicInterpreter()
+	if got := strings.Join(printed(t, bi, program), " "); got != "1000000 1000000 1234.5 0.25" {
+		t.Errorf("default format: %s", got)
+	}
+
+	bi.FixedDecimals = 2
+	if got := strings.Join(printed(t, bi, program), " "); got != "1000000.00 1000000.00 1234.50 0.25" {
+		t.Errorf("two decimals: %s", got)
+	}
+
+	bi.ThousandsSeparator = true
+	if got := strings.Join(printed(t, bi, program), " "); got != "1,000,000.00 1,000,000.00 1,234.50 0.25" {
+		t.Errorf("two decimals with separators: %s", got)
+	}
+}
+
+func TestNumericOverflow(t *testing.T) {
+	quietStdout(t)
+	for _, test := range []struct {
+		program       string
+		floatDivision bool
+	}{
+		{"10 LET A = 1E200\n20 PRINT A * A", false},
+		{"10 PRINT 1E308 / 0.001", false},
+		{"10 PRINT 1E308 / 0.001", true},
+	} {
+		bi := NewBasicInterpreter()
+		bi.FloatDivision = test.floatDivision
+		err := bi.Run(test.program)
+		var basicErr *BasicError
+		if !errors.As(err, &basicErr) || !strings.Contains(err.Error(), "numeric overflow") {
+			t.Errorf("%q: got %v, want a numeric overflow", test.program, err)
+			continue
+		}
+		lastLine := strings.Count(test.program, "\n")*10 + 10
+		if basicErr.Line != lastLine {
+			t.Errorf("%q: overflow reported at line %d, want %d", test.program, basicErr.Line, lastLine)
+		}
+		if len(bi.GetOutput()) != 0 {
+			t.Errorf("%q: printed %q", test.program, bi.GetOutput())
+		}
+	}
+}
+
+func TestResetKeepsProgram(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	if err := bi.LoadProgram("10 FOR I = 1 TO 2\n20 PRINT I\n30 NEXT I\n40 LET DONE = 1"); err != nil {
+		t.Fatal(err)
+	}
+	for run := 1; run <= 2; run++ {
+		if err := bi.Execute(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if got := bi.GetOutput(); len(got) != 2 || got[0] != "1" || got[1] != "2" {
+			t.Errorf("run %d: output %q, want 1 and 2", run, got)
+		}
+		bi.Reset()
+		if _, exists := bi.GetVariable("DONE"); exists {
+			t.Errorf("run %d: DONE survived Reset", run)
+		}
+		if len(bi.GetOutput()) != 0 || len(bi.forStack) != 0 {
+			t.Errorf("run %d: output or loops survived Reset", run)
+		}
+	}
+	if bi.List() == "" {
+		t.Error("Reset dropped the program")
+	}
+}
+
+func TestClsClearsOutput(t *testing.T) {
+	quietStdout(t)
+	got := printed(t, NewBasicInterpreter(), "10 PRINT \"OLD\"\n20 CLS\n30 PRINT \"NEW 1\"\n40 PRINT \"NEW 2\"")
+	if len(got) != 2 || got[0] != "NEW 1" || got[1] != "NEW 2" {
+		t.Errorf("output %q, want only the lines after CLS", got)
+	}
+}
+
+func TestSetAndGetVariable(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	if err := bi.LoadProgram("10 LET B = N * 2\n20 LET G$ = \"HI \"\n30 PRINT G$; NAME$"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bi.SetVariable("N", int64(21)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bi.SetVariable("NAME$", "BOB"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bi.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if value, exists := bi.GetVariable("B"); !exists || value != 42 {
+		t.Errorf("B = %v, %v; want 42", value, exists)
+	}
+	if _, exists := bi.GetVariable("MISSING"); exists {
+		t.Error("GetVariable found a variable that was never set")
+	}
+
+	if err := bi.SetVariable("NAME$", 5); err == nil {
+		t.Error("SetVariable stored a number in a string variable")
+	}
+	if err := bi.SetVariable("COUNT%", 2.9); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := bi.GetVariable("COUNT%"); value != 2 {
+		t.Errorf("COUNT%% = %v, want 2", value)
+	}
+}
+
+func TestBasicErrorFields(t *testing.T) {
+	quietStdout(t)
+	for _, test := range []struct {
+		program   string
+		line      int
+		statement string
+		kind      ErrorKind
+		message   string
+	}{
+		{"10 LET A = 1\n20 PRINT A / 0", 20, "PRINT A / 0", KindRuntime, "error at line 20: error evaluating expression 'A / 0': division by zero"},
+		{"10 GOTO 99", 10, "GOTO 99", KindUndefinedLine, "error at line 10: undefined line number 99 in GOTO statement"},
+		{"10 FROB", 10, "FROB", KindSyntax, "error at line 10: syntax error: unknown command 'FROB'"},
+	} {
+		err := NewBasicInterpreter().Run(test.program)
+		var basicErr *BasicError
+		if !errors.As(err, &basicErr) {
+			t.Errorf("%q: got %T %v, want a *BasicError", test.program, err, err)
+			continue
+		}
+		if basicErr.Line != test.line || basicErr.Statement != test.statement || basicErr.Kind != test.kind {
+			t.Errorf("%q: got line %d, statement %q, kind %s; want %d, %q, %s", test.program,
+				basicErr.Line, basicErr.Statement, basicErr.Kind, test.line, test.statement, test.kind)
+		}
+		if err.Error() != test.message {
+			t.Errorf("%q: message %q, want %q", test.program, err.Error(), test.message)
+		}
+	}
+}
+
+func TestGotoLabels(t *testing.T) {
+	quietStdout(t)
+	got := printed(t, NewBasicInterpreter(), `10 LET I = 0
+20 LOOP: LET I = I + 1
+30 IF I < 3 THEN GOTO LOOP
+40 GOTO 60
+50 PRINT "SKIPPED"
+60 PRINT I
+70 GOTO ENDLOOP
+80 PRINT "SKIPPED"
+90 ENDLOOP: PRINT "DONE"`)
+	if strings.Join(got, " ") != "3 DONE" {
+		t.Errorf("output %q, want 3 DONE", got)
+	}
+}
+
+func TestGotoUndefinedLabel(t *testing.T) {
+	err := NewBasicInterpreter().Run("10 GOTO NOWHERE")
+	var basicErr *BasicError
+	if !errors.As(err, &basicErr) || basicErr.Kind != KindUndefinedLine || !strings.Contains(err.Error(), "undefined label NOWHERE") {
+		t.Errorf("got %v, want an undefined label error", err)
+	}
+}
+
+func TestLabelsStartingWithKeywords(t *testing.T) {
+	program, err := Parse("10 ENDLOOP: REM\n20 FORMAT: REM\n30 PRINT: REM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Labels["ENDLOOP"] != 10 || program.Labels["FORMAT"] != 20 {
+		t.Errorf("labels %v, want ENDLOOP at 10 and FORMAT at 20", program.Labels)
+	}
+	if _, exists := program.Labels["PRINT"]; exists {
+		t.Error("the keyword PRINT was taken as a label")
+	}
+}
+
+func TestDuplicateLabel(t *testing.T) {
+	if _, err := Parse("10 A: REM\n20 A: REM"); err == nil || !strings.Contains(err.Error(), "duplicate label A") {
+		t.Errorf("got %v, want a duplicate label error", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	bi := NewBasicInterpreter()
+	err := bi.LoadProgram(`10 PRINT "OK"
+20 FROB 3
+30 PRINT "OK
+40 FOR I = 1 UNTIL 3
+50 IF A > 1 PRINT "X"
+60 GOTO 10`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := bi.Validate()
+	var lines []int
+	for _, problem := range problems {
+		if problem.Kind != KindSyntax {
+			t.Errorf("line %d: kind %s, want syntax", problem.Line, problem.Kind)
+		}
+		lines = append(lines, problem.Line)
+	}
+	if fmt.Sprint(lines) != "[20 30 40 50]" {
+		t.Errorf("problems at lines %v, want [20 30 40 50]: %v", lines, problems)
+	}
+	if len(bi.GetOutput()) != 0 {
+		t.Error("Validate ran the program")
+	}
+}
+
+func TestStrictRejectsReusedForVariable(t *testing.T) {
+	quietStdout(t)
+	program := `10 FOR I = 1 TO 3
+20 FOR I = 1 TO 5
+30 NEXT I
+40 NEXT I`
+
+	if err := NewBasicInterpreter().Run(program); err != nil {
+		t.Errorf("without Strict: %v", err)
+	}
+
+	bi := NewBasicInterpreter()
+	bi.Strict = true
+	err := bi.Run(program)
+	var basicErr *BasicError
+	if !errors.As(err, &basicErr) || basicErr.Line != 20 ||
+		!strings.Contains(err.Error(), "FOR I at line 10 is still active (missing NEXT I?)") {
+		t.Errorf("got %v, want the active FOR I at line 10 reported at line 20", err)
+	}
+}
+
+func TestLastErrorIsTyped(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+	err := bi.Run("10 PRINT 1\n20 GOTO 99")
+	if bi.LastError() != err {
+		t.Fatalf("LastError() = %v, want the error from Run %v", bi.LastError(), err)
+	}
+	var basicErr *BasicError
+	if !errors.As(bi.LastError(), &basicErr) || basicErr.Line != 20 || basicErr.Kind != KindUndefinedLine {
+		t.Errorf("LastError() = %#v, want an undefined-line *BasicError at line 20", bi.LastError())
+	}
+
+	if err := bi.Run("10 PRINT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if bi.LastError() != nil {
+		t.Errorf("LastError() = %v after a successful run, want nil", bi.LastError())
+	}
+}
+
+func TestUnusableLineNumbers(t *testing.T) {
+	for _, test := range []struct {
+		program string
+		message string
+	}{
+		{"10 PRINT 1\n99999999999999999999 PRINT 2", "source line 2: line number 99999999999999999999 is out of range"},
+		{"10 PRINT 1\n\n1234567890123456789012 PRINT 2", "source line 3: line number 1234567890123456789012 is out of range"},
+	} {
+		err := NewBasicInterpreter().LoadProgram(test.program)
+		var basicErr *BasicError
+		if !errors.As(err, &basicErr) || basicErr.Kind != KindSyntax || basicErr.Line != NoLine {
+			t.Errorf("%q: got %v, want a syntax error without a line", test.program, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%q: got %q, want %q", test.program, err.Error(), test.message)
+		}
+	}
+}
+
+func TestExecuteLine(t *testing.T) {
+	quietStdout(t)
+	bi := NewBasicInterpreter()
+
+	if err := bi.ExecuteLine("PRINT 2+2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); len(got) != 1 || got[0] != "4" {
+		t.Errorf("output %q, want 4", got)
+	}
+
+	if err := bi.ExecuteLine("LET A=5"); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := bi.GetVariable("A"); !ok || value != 5 {
+		t.Errorf("A = %v, %v; want 5", value, ok)
+	}
+	if err := bi.ExecuteLine("PRINT A*2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); len(got) != 2 || got[1] != "10" {
+		t.Errorf("output %q, want 10 computed from the earlier LET", got)
+	}
+
+	for _, statement := range []string{"GOTO 10", "FOR I = 1 TO 3", "NEXT I"} {
+		if err := bi.ExecuteLine(statement); err == nil || !strings.Contains(err.Error(), "not allowed in immediate mode") {
+			t.Errorf("%s: got %v, want it rejected in immediate mode", statement, err)
+		}
+	}
+}
+
+func TestParseWithoutExecuting(t *testing.T) {
+	quietStdout(t)
+	// Neither the runtime error at 30 nor the undefined label at 40 is
+	// Parse's concern
+	program, err := Parse("30 PRINT 1/0\n\n10 START: LET A = A + 1\n  20 PRINT A  \n40 GOTO NOWHERE\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(program.LineNumbers) != "[10 20 30 40]" {
+		t.Errorf("line numbers %v, want [10 20 30 40]", program.LineNumbers)
+	}
+	if program.Lines[20] != "PRINT A" || program.Lines[10] != "START: LET A = A + 1" {
+		t.Errorf("lines %v", program.Lines)
+	}
+	if len(program.Labels) != 1 || program.Labels["START"] != 10 {
+		t.Errorf("labels %v, want START at 10", program.Labels)
+	}
+	if got := program.ListRange(20, 30); got != "20 PRINT A\n30 PRINT 1/0\n" {
+		t.Errorf("ListRange(20, 30) = %q", got)
+	}
+
+	// One parse can be run any number of times, each from a clean slate
+	program, err = Parse("10 LET A = 1\n20 LET A = A + 1\n30 PRINT A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		bi := NewBasicInterpreter()
+		if err := bi.RunProgram(program); err != nil {
+			t.Fatal(err)
+		}
+		if got := bi.GetOutput(); len(got) != 1 || got[0] != "2" {
+			t.Errorf("run %d printed %q, want 2", run+1, got)
+		}
+	}
+	if len(program.Lines) != 3 || program.Lines[20] != "LET A = A + 1" {
+		t.Errorf("running changed the program: %v", program.Lines)
+	}
+
+	program, err = Parse("10 PRINT 1\n99999999999999999999 PRINT 2\n30 PRINT 3")
+	var basicErr *BasicError
+	if program != nil || !errors.As(err, &basicErr) || basicErr.Kind != KindSyntax || !strings.Contains(err.Error(), "source line 2: line number 99999999999999999999 is out of range") {
+		t.Errorf("got %v, %v; want a syntax error for source line 2", program, err)
+	}
+}
+
+func TestLineNumberWithoutSpace(t *testing.T) {
+	quietStdout(t)
+	program, err := Parse("10PRINT \"hi\"\n20LET A=2\n30 PRINT A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Lines[10] != `PRINT "hi"` || program.Lines[20] != "LET A=2" {
+		t.Errorf("lines %v, want the statements after the line numbers", program.Lines)
+	}
+	bi := NewBasicInterpreter()
+	if err := bi.RunProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if got := bi.GetOutput(); strings.Join(got, " ") != "hi 2" {
+		t.Errorf("output %q, want hi 2", got)
+	}
+}
+
+func TestLineNumberOnly(t *testing.T) {
+	for _, text := range []string{"10 PRINT 1\n20\n30 PRINT 3", "10 PRINT 1\n20"} {
+		_, err := Parse(text)
+		var basicErr *BasicError
+		if !errors.As(err, &basicErr) || basicErr.Kind != KindSyntax || basicErr.Line != 20 {
+			t.Errorf("%q: got %v, want a syntax error at line 20", text, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), "no statement after the line number") {
+			t.Errorf("%q: got %q, want it to say the statement is missing", text, err.Error())
+		}
+	}
+}
+
+// quietStdout sends PRINT's echo to the null device for the rest of the test
+func quietStdout(tb testing.TB) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = null
+	tb.Cleanup(func() {
+		os.Stdout = stdout
+		null.Close()
+	})
+}
+
+func BenchmarkRunOutput(b *testing.B) {
+	const lines = 1000
+	program, err := Parse(`10 FOR I = 1 TO 1000
+20 PRINT "LINE "; I
+30 NEXT I`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	quietStdout(b)
+
+	for _, bench := range []struct {
+		name     string
+		capacity int
+	}{
+		{"Default", 0},
+		{"OutputCapacity", lines},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				bi := NewBasicInterpreter()
+				bi.OutputCapacity = bench.capacity
+				if err := bi.RunProgram(program); err != nil {
+					b.Fatal(err)
+				}
+				if got := len(bi.GetOutput()); got != lines {
+					b.Fatalf("got %d output lines, want %d", got, lines)
+				}
+			}
+		})
+	}
+}
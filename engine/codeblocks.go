@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a fenced code block extracted from an LLM response
+type CodeBlock struct {
+	Language string
+	Filename string
+	Content  string
+}
+
+// fileHintPattern matches a "// File: path" style comment on the first line of a block
+var fileHintPattern = regexp.MustCompile(`^\s*(?://|#|')\s*(?i:file(?:name)?)\s*:\s*(\S+)`)
+
+// extractCodeBlocks finds all fenced code blocks in a response. The info
+// string after the opening fence may give a language, a filename, or both
+// ("```go", "```go main.go", "```go:main.go"); a "// File: name" comment on
+// the first line of the block is also accepted as a filename hint.
+func extractCodeBlocks(response string) []CodeBlock {
+	var blocks []CodeBlock
+	var current *CodeBlock
+	var content []string
+
+	for _, line := range strings.Split(response, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if current == nil {
+			if strings.HasPrefix(trimmed, "```") {
+				current = parseFenceInfo(strings.TrimPrefix(trimmed, "```"))
+				content = nil
+			}
+			continue
+		}
+
+		if trimmed == "```" {
+			current.Content = strings.Join(content, "\n") + "\n"
+			blocks = append(blocks, finishBlock(*current))
+			current = nil
+			continue
+		}
+
+		content = append(content, strings.TrimRight(line, "\r"))
+	}
+
+	// Keep a block left open by a truncated response
+	if current != nil && len(content) > 0 {
+		current.Content = strings.Join(content, "\n") + "\n"
+		blocks = append(blocks, finishBlock(*current))
+	}
+
+	return blocks
+}
+
+// parseFenceInfo splits a fence info string into language and filename
+func parseFenceInfo(info string) *CodeBlock {
+	block := &CodeBlock{}
+	fields := strings.FieldsFunc(info, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ':'
+	})
+	for _, field := range fields {
+		if strings.ContainsAny(field, "./") {
+			block.Filename = field
+		} else if block.Language == "" {
+			block.Language = strings.ToLower(field)
+		}
+	}
+	return block
+}
+
+// finishBlock fills in the filename and language from hints in the content
+func finishBlock(block CodeBlock) CodeBlock {
+	if block.Filename == "" {
+		firstLine := strings.SplitN(block.Content, "\n", 2)[0]
+		if match := fileHintPattern.FindStringSubmatch(firstLine); match != nil {
+			block.Filename = match[1]
+		}
+	}
+	if block.Language == "" && block.Filename != "" {
+		block.Language = strings.TrimPrefix(filepath.Ext(block.Filename), ".")
+	}
+	return block
+}
+
+// defaultFilename picks a filename for a block without a filename hint
+func defaultFilename(language string, index int) string {
+	switch language {
+	case "go", "golang":
+		return "main.go"
+	case "basic", "bas":
+		return "program.bas"
+	case "":
+		return fmt.Sprintf("block%d.txt", index+1)
+	default:
+		return fmt.Sprintf("block%d.%s", index+1, language)
+	}
+}
+
+// writeCodeBlocks writes extracted blocks into the workspace and returns the
+// relative paths written. Go files are gofmt-formatted first; files that
+// fail to format are written unchanged and reported in formatErrors, as
+// they almost certainly contain invalid code. Blocks whose filename would
+// escape the workspace are skipped.
+func (e *Engine) writeCodeBlocks(blocks []CodeBlock) (written []string, formatErrors map[string]error, err error) {
+	formatErrors = make(map[string]error)
+	used := make(map[string]bool)
+
+	for i, block := range blocks {
+		name := block.Filename
+		if name == "" {
+			name = defaultFilename(block.Language, i)
+			// Avoid overwriting an earlier unnamed block of the same language
+			base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+			for n := 2; used[name]; n++ {
+				name = fmt.Sprintf("%s_%d%s", base, n, ext)
+			}
+		}
+
+		relPath := filepath.Clean(filepath.FromSlash(name))
+		if filepath.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			log.Printf("Warning: skipping code block with unsafe path %s", name)
+			continue
+		}
+		used[name] = true
+
+		content := []byte(block.Content)
+		if filepath.Ext(relPath) == ".go" {
+			formatted, err := format.Source(content)
+			if err != nil {
+				log.Printf("Warning: %s failed to format: %v", relPath, err)
+				formatErrors[relPath] = err
+			} else {
+				content = formatted
+			}
+		}
+
+		fullPath := filepath.Join(e.config.WorkspaceDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return written, formatErrors, fmt.Errorf("failed to create directory for %s: %v", relPath, err)
+		}
+		if err := os.WriteFile(fullPath, content, 0644); err != nil {
+			return written, formatErrors, fmt.Errorf("failed to write %s: %v", relPath, err)
+		}
+
+		log.Printf("Wrote %s (%d bytes)", relPath, len(content))
+		written = append(written, relPath)
+	}
+
+	return written, formatErrors, nil
+}
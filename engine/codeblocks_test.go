@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestEngine returns an engine working in a fresh temporary workspace
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	return &Engine{config: &Config{WorkspaceDir: t.TempDir(), Target: defaultTarget()}}
+}
+
+func TestExtractCodeBlocks(t *testing.T) {
+	response := "Here is the code:\n" +
+		"```go main.go\npackage main\n```\n" +
+		"and a helper:\n" +
+		"```go:lexer/lexer.go\npackage lexer\n```\n" +
+		"```\n// File: notes.txt\nhello\n```\n" +
+		"```basic\n10 PRINT \"HI\"\n```\n" +
+		"```go\npackage main // cut off"
+
+	want := []CodeBlock{
+		{Language: "go", Filename: "main.go", Content: "package main\n"},
+		{Language: "go", Filename: "lexer/lexer.go", Content: "package lexer\n"},
+		{Language: "txt", Filename: "notes.txt", Content: "// File: notes.txt\nhello\n"},
+		{Language: "basic", Content: "10 PRINT \"HI\"\n"},
+		{Language: "go", Content: "package main // cut off\n"},
+	}
+	if got := extractCodeBlocks(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestWriteCodeBlocks(t *testing.T) {
+	e := newTestEngine(t)
+	blocks := []CodeBlock{
+		{Language: "go", Filename: "cmd/tool.go", Content: "package main\n"},
+		{Language: "go", Content: "package main\n\nfunc a() {}\n"},
+		{Language: "go", Content: "package main\n\nfunc b() {}\n"},
+		{Language: "go", Filename: "../escape.go", Content: "package main\n"},
+		{Language: "basic", Content: "10 END\n"},
+	}
+
+	written, _, err := e.writeCodeBlocks(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		filepath.Join("cmd", "tool.go"): blocks[0].Content,
+		"main.go":                       blocks[1].Content,
+		"main_2.go":                     blocks[2].Content,
+		"program.bas":                   blocks[4].Content,
+	}
+	if len(written) != len(want) {
+		t.Errorf("wrote %v, want %d files", written, len(want))
+	}
+	for _, path := range written {
+		content, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if wantContent, ok := want[path]; !ok || string(content) != wantContent {
+			t.Errorf("%s holds %q, want %q", path, content, wantContent)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(e.config.WorkspaceDir), "escape.go")); err == nil {
+		t.Error("a block escaped the workspace")
+	}
+}
+
+func TestWriteCodeBlocksFormatsGo(t *testing.T) {
+	e := newTestEngine(t)
+	malformed := "package main\n\nfunc main() {\n"
+	blocks := []CodeBlock{
+		{Language: "go", Filename: "good.go", Content: "package main\nfunc  main( ){\nx:=1\n_ = x}\n"},
+		{Language: "go", Filename: "bad.go", Content: malformed},
+	}
+
+	_, formatErrors, err := e.writeCodeBlocks(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, "good.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n"; string(good) != want {
+		t.Errorf("good.go holds %q, want the gofmt output %q", good, want)
+	}
+
+	bad, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, "bad.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bad) != malformed {
+		t.Errorf("bad.go holds %q, want it written unchanged", bad)
+	}
+	if len(formatErrors) != 1 || formatErrors["bad.go"] == nil {
+		t.Errorf("format errors %v, want just bad.go", formatErrors)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expectOutputDirective marks a REM line that declares one line of a
+// program's expected output, e.g. `10 REM @expect-output Hello`
+const expectOutputDirective = "@expect-output"
+
+// parseExpectDirectives collects the expected output lines declared by
+// REM @expect-output directives in a BASIC program, in program order.
+// found is false when the program declares no expected output.
+func parseExpectDirectives(source string) (lines []string, found bool) {
+	for _, line := range strings.Split(source, "\n") {
+		// Only leading space is dropped, as trailing space may be output
+		line = strings.TrimLeft(strings.TrimSuffix(line, "\r"), " \t")
+
+		// Drop the line number
+		if i := strings.IndexFunc(line, func(r rune) bool { return r < '0' || r > '9' }); i > 0 {
+			line = strings.TrimLeft(line[i:], " \t")
+		}
+
+		if !strings.HasPrefix(line, "REM") {
+			continue
+		}
+		comment := strings.TrimLeft(line[3:], " \t")
+		if !strings.HasPrefix(comment, expectOutputDirective) {
+			continue
+		}
+
+		// Everything after the single separating space is output, so
+		// indentation and trailing spaces are preserved
+		text := strings.TrimPrefix(comment[len(expectOutputDirective):], " ")
+		lines = append(lines, text)
+		found = true
+	}
+	return lines, found
+}
+
+// writeExpectFixtures generates tests/expected/<name>.txt for each written
+// test program under tests/basic that declares its expected output with
+// directives, returning the fixture paths written. Programs in
+// subdirectories get fixtures at the same relative path.
+func (e *Engine) writeExpectFixtures(written []string) ([]string, error) {
+	var fixtures []string
+	testsDir := filepath.Join("tests", "basic")
+
+	for _, path := range written {
+		rel, err := filepath.Rel(testsDir, path)
+		if filepath.Ext(path) != ".bas" || err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		source, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, path))
+		if err != nil {
+			return fixtures, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		lines, found := parseExpectDirectives(string(source))
+		if !found {
+			continue
+		}
+
+		name := strings.TrimSuffix(rel, ".bas")
+		fixture := filepath.Join("tests", "expected", name+".txt")
+		content := strings.Join(lines, "\n") + "\n"
+
+		fullPath := filepath.Join(e.config.WorkspaceDir, fixture)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fixtures, fmt.Errorf("failed to create directory for %s: %v", fixture, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			return fixtures, fmt.Errorf("failed to write %s: %v", fixture, err)
+		}
+
+		log.Printf("Generated %s from %d @expect-output directive(s) in %s", fixture, len(lines), path)
+		fixtures = append(fixtures, fixture)
+	}
+
+	return fixtures, nil
+}
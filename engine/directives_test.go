@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseExpectDirectives(t *testing.T) {
+	source := `10 REM @expect-output Hello
+20 PRINT "Hello"
+30 REM an ordinary comment
+40 REM @expect-output   indented 
+50REM @expect-output
+60 PRINT "REM @expect-output not a directive"
+`
+	lines, found := parseExpectDirectives(source)
+	if want := []string{"Hello", "  indented ", ""}; !found || !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %q, %v; want %q", lines, found, want)
+	}
+
+	if lines, found := parseExpectDirectives("10 REM nothing expected\n20 END\n"); found {
+		t.Errorf("found %q in a program without directives", lines)
+	}
+}
+
+func TestWriteExpectFixtures(t *testing.T) {
+	captureLog(t)
+	e := newTestEngine(t)
+	programs := map[string]string{
+		filepath.Join("tests", "basic", "loops", "count.bas"): "10 REM @expect-output 1\n20 REM @expect-output 2\n30 FOR I = 1 TO 2\n40 PRINT I\n50 NEXT I\n",
+		filepath.Join("tests", "basic", "plain.bas"):          "10 PRINT \"NO DIRECTIVES\"\n",
+		"other.bas": "10 REM @expect-output outside the tests\n",
+	}
+	var written []string
+	for path, source := range programs {
+		fullPath := filepath.Join(e.config.WorkspaceDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, path)
+	}
+
+	fixtures, err := e.writeExpectFixtures(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := filepath.Join("tests", "expected", "loops", "count.txt")
+	if !reflect.DeepEqual(fixtures, []string{fixture}) {
+		t.Fatalf("wrote %v, want just %s", fixtures, fixture)
+	}
+	content, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "1\n2\n" {
+		t.Errorf("%s holds %q, want the declared output", fixture, content)
+	}
+}
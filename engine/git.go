@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patterns for the counts in the test runner's summary
+var (
+	testsRunPattern    = regexp.MustCompile(`(?m)^Tests run: (\d+)`)
+	testsPassedPattern = regexp.MustCompile(`(?m)^Passed: (\d+)`)
+)
+
+// parseTestCounts extracts the passed and total test counts from the test
+// runner output; ok is false if the summary is missing
+func parseTestCounts(output string) (passed, total int, ok bool) {
+	run := testsRunPattern.FindStringSubmatch(output)
+	pass := testsPassedPattern.FindStringSubmatch(output)
+	if run == nil || pass == nil {
+		return 0, 0, false
+	}
+	total, _ = strconv.Atoi(run[1])
+	passed, _ = strconv.Atoi(pass[1])
+	return passed, total, true
+}
+
+// gitCommitter commits the workspace to a git repository, creating the
+// repository on first use. A nil committer does nothing, which is how a
+// missing git binary is handled.
+type gitCommitter struct {
+	dir      string
+	artifact string
+}
+
+// newGitCommitter returns a committer for dir that ignores the built
+// artifact, or nil with a warning if git is not installed
+func newGitCommitter(dir, artifact string) *gitCommitter {
+	if _, err := exec.LookPath("git"); err != nil {
+		log.Printf("Warning: git_commit is enabled but git is not installed, continuing without commits")
+		return nil
+	}
+	return &gitCommitter{dir: dir, artifact: artifact}
+}
+
+// git runs a git command in the workspace. The identity is passed
+// explicitly so commits work without any global git configuration.
+func (g *gitCommitter) git(args ...string) (string, error) {
+	args = append([]string{"-c", "user.name=Ardilea Engine", "-c", "user.email=engine@ardilea.local"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("git %s: %v: %s", args[4], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// ensureRepo initializes the workspace repository if there is none,
+// ignoring the built artifact
+func (g *gitCommitter) ensureRepo() error {
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); err == nil {
+		return nil
+	}
+
+	log.Printf("Initializing git repository in %s", g.dir)
+	if _, err := g.git("init"); err != nil {
+		return err
+	}
+
+	ignorePath := filepath.Join(g.dir, ".gitignore")
+	if _, err := os.Stat(ignorePath); os.IsNotExist(err) {
+		if err := os.WriteFile(ignorePath, []byte("/"+filepath.ToSlash(g.artifact)+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write .gitignore: %v", err)
+		}
+	}
+	return nil
+}
+
+// commit stages everything in the workspace and commits it. Failures are
+// logged rather than returned, since the audit trail is best-effort.
+func (g *gitCommitter) commit(message string) {
+	if g == nil {
+		return
+	}
+
+	if err := g.ensureRepo(); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	if _, err := g.git("add", "-A"); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	if output, err := g.git("commit", "-q", "-m", message); err != nil {
+		if strings.Contains(output, "nothing to commit") {
+			return
+		}
+		log.Printf("Warning: %v", err)
+		return
+	}
+	log.Printf("Committed workspace: %s", message)
+}
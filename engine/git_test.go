@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reportingProgram is a response holding a program that prints a test
+// runner summary with passed of 2 tests passing
+func reportingProgram(passed string) string {
+	body := "\tos.Stdout.WriteString(\"Tests run: 2\\nPassed: " + passed + "\\n\")"
+	if passed != "2" {
+		body += "\n\tos.Exit(1)"
+	}
+	return goProgram(body)
+}
+
+func TestParseTestCounts(t *testing.T) {
+	passed, total, ok := parseTestCounts("Running tests...\nTests run: 12\nPassed: 9\nFailed: 3\n")
+	if !ok || passed != 9 || total != 12 {
+		t.Errorf("got %d/%d, %v; want 9/12", passed, total, ok)
+	}
+	if _, _, ok := parseTestCounts("panic: runtime error\n"); ok {
+		t.Error("found counts in output without a summary")
+	}
+}
+
+func TestGitCommitPerImprovedIteration(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	captureLog(t)
+	generator := &fakeGenerator{responses: []string{reportingProgram("1"), reportingProgram("1"), reportingProgram("2")}}
+	e := newIteratingEngine(t, generator, 3)
+	e.config.GitCommit = true
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("git", "log", "--format=%s")
+	cmd.Dir = e.config.WorkspaceDir
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := strings.Split(strings.TrimSpace(string(output)), "\n")
+	want := []string{"iteration 3: 2/2 tests passing", "iteration 1: 1/2 tests passing"}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("commits %q, want %q", commits, want)
+	}
+
+	cmd = exec.Command("git", "ls-files")
+	cmd.Dir = e.config.WorkspaceDir
+	if output, err = cmd.Output(); err != nil {
+		t.Fatal(err)
+	}
+	if files := strings.Fields(string(output)); !reflect.DeepEqual(files, []string{".gitignore", "main.go"}) {
+		t.Errorf("committed %q, want the source without the built artifact", files)
+	}
+}
+
+func TestGitCommitWithoutGit(t *testing.T) {
+	logged := captureLog(t)
+	t.Setenv("PATH", t.TempDir())
+
+	committer := newGitCommitter(t.TempDir(), "tool")
+	if committer != nil {
+		t.Fatal("got a committer without git installed")
+	}
+	committer.commit("iteration 1: 0/1 tests passing")
+	if !strings.Contains(logged.String(), "git is not installed, continuing without commits") {
+		t.Errorf("no warning logged:\n%s", logged)
+	}
+}
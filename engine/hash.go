@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
+// defaultHashAlgorithm is used for snapshots when hash_algorithm is unset
+const defaultHashAlgorithm = "md5"
+
+// hashAlgorithms maps the hash_algorithm names to their constructors.
+// crc32 is much faster than the others but only suitable for spotting
+// changes, not for anything security related.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+}
+
+// newHash returns a hash for the named algorithm, or the default if name
+// is empty
+func newHash(name string) (hash.Hash, error) {
+	if name == "" {
+		name = defaultHashAlgorithm
+	}
+	newFunc, ok := hashAlgorithms[name]
+	if !ok {
+		names := make([]string, 0, len(hashAlgorithms))
+		for n := range hashAlgorithms {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown hash algorithm %q (expected one of %s)", name, strings.Join(names, ", "))
+	}
+	return newFunc(), nil
+}
+
+// hashAlgorithm returns the configured snapshot hash algorithm
+func (e *Engine) hashAlgorithm() string {
+	if e.config.HashAlgorithm == "" {
+		return defaultHashAlgorithm
+	}
+	return e.config.HashAlgorithm
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHashAlgorithms(t *testing.T) {
+	e := newTestEngine(t)
+	writeFile(t, e.config.WorkspaceDir, "hello.txt", "hello world\n")
+	path := filepath.Join(e.config.WorkspaceDir, "hello.txt")
+
+	for _, test := range []struct {
+		algorithm string
+		want      string
+	}{
+		{"", "6f5902ac237024bdd0c176cb93063dc4"},
+		{"md5", "6f5902ac237024bdd0c176cb93063dc4"},
+		{"sha256", "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"},
+		{"crc32", "af083b2d"},
+	} {
+		e.config.HashAlgorithm = test.algorithm
+		for i := 0; i < 2; i++ {
+			got, err := e.calculateFileHash(path)
+			if err != nil {
+				t.Fatalf("%q: %v", test.algorithm, err)
+			}
+			if got != test.want {
+				t.Errorf("%q hash %s, want %s", test.algorithm, got, test.want)
+			}
+		}
+		snapshot, err := e.takeWorkspaceSnapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snapshot.HashAlgorithm != e.hashAlgorithm() || snapshot.Files["hello.txt"].Hash != test.want {
+			t.Errorf("%q snapshot records %s and hash %s", test.algorithm, snapshot.HashAlgorithm, snapshot.Files["hello.txt"].Hash)
+		}
+	}
+
+	if _, err := newHash("sha1"); err == nil {
+		t.Error("newHash accepted sha1")
+	}
+}
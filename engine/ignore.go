@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultIgnorePatterns are always left out of snapshots and scans, on top
+// of hidden files and any configured ignore_patterns. They cover common
+// build output and the files the engine itself writes to the workspace.
+var defaultIgnorePatterns = []string{
+	"node_modules/",
+	"*.o",
+	"/workspace-report.json",
+	"/workspace-summary.txt",
+	"/transcript-*.md",
+}
+
+// ignoreMatcher decides which workspace paths to skip using gitignore-style
+// globs. A pattern containing a slash is matched against the whole path
+// from the workspace root, otherwise against each path's base name; a
+// trailing slash restricts a pattern to directories. Negation and ** are
+// not supported.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	glob     string
+	anchored bool // match the full relative path rather than the base name
+	dirOnly  bool
+}
+
+// newIgnoreMatcher combines the default patterns with the configured ones
+func newIgnoreMatcher(patterns []string) *ignoreMatcher {
+	m := &ignoreMatcher{}
+	for _, p := range append(append([]string{}, defaultIgnorePatterns...), patterns...) {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		var pattern ignorePattern
+		if strings.HasSuffix(p, "/") {
+			pattern.dirOnly = true
+			p = strings.TrimSuffix(p, "/")
+		}
+		if strings.Contains(p, "/") {
+			pattern.anchored = true
+			p = strings.TrimPrefix(p, "/")
+		}
+		pattern.glob = p
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m
+}
+
+// ignored reports whether relPath, relative to the workspace root, matches
+// any pattern. Hidden files and directories are always ignored.
+func (m *ignoreMatcher) ignored(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	base := path.Base(relPath)
+	if strings.HasPrefix(base, ".") {
+		return true
+	}
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		name := base
+		if p.anchored {
+			name = relPath
+		}
+		if ok, _ := path.Match(p.glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
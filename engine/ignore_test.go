@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	e := newTestEngine(t)
+	e.config.IgnorePatterns = []string{"build/", "*.log", "/docs/draft.md", "# a comment", ""}
+	for _, path := range []string{
+		"main.go",
+		"build/out.bin",
+		"build/sub/deep.txt",
+		"cmd/build", // a file, not a directory
+		"run.log",
+		"cmd/trace.log",
+		"docs/draft.md",
+		"docs/final.md",
+		"cmd/docs/draft.md",
+		"node_modules/pkg/index.js",
+		"lexer.o",
+		".env",
+		"workspace-report.json",
+		"transcript-20240501-120000.md",
+	} {
+		writeFile(t, e.config.WorkspaceDir, path, "x")
+	}
+	want := []string{"cmd", "cmd/build", "cmd/docs", "cmd/docs/draft.md", "docs", "docs/final.md", "main.go"}
+
+	snapshot, err := e.takeWorkspaceSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Files) != len(want) {
+		t.Errorf("snapshot has %d entries, want %d: %v", len(snapshot.Files), len(want), snapshot.Files)
+	}
+	for _, path := range want {
+		if _, ok := snapshot.Files[filepath.FromSlash(path)]; !ok {
+			t.Errorf("snapshot lacks %s", path)
+		}
+	}
+
+	entries, err := e.scanWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned []string
+	for _, entry := range entries {
+		scanned = append(scanned, filepath.ToSlash(entry.path))
+	}
+	if !reflect.DeepEqual(scanned, want) {
+		t.Errorf("scanned %q, want %q", scanned, want)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// developIteratively runs the generate, build and test loop. Each round
+// writes the code from the LLM response, builds and vets it and runs the
+// test suite; compiler, vet and test failures are fed back to the model in
+// the next prompt until the tests pass or MaxIterations is reached.
+func (e *Engine) developIteratively(prompt string) error {
+	goFiles := make(map[string]bool)
+	var changes string
+	e.conversation = nil
+
+	var committer *gitCommitter
+	if e.config.GitCommit {
+		committer = newGitCommitter(e.config.WorkspaceDir, e.config.Target.Artifact)
+	}
+	bestPassed := -1
+
+	for iteration := 1; iteration <= e.config.MaxIterations; iteration++ {
+		log.Printf("=== Iteration %d of %d ===", iteration, e.config.MaxIterations)
+		e.transcript.section(fmt.Sprintf("Iteration %d of %d", iteration, e.config.MaxIterations))
+
+		response, err := e.generate(prompt, "Generated Code")
+		if errors.Is(err, errTokenBudget) {
+			log.Printf("Stopping: %v", err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get LLM response: %v", err)
+		}
+
+		blocks := extractCodeBlocks(response)
+		if len(blocks) == 0 {
+			log.Println("No code blocks found in LLM response")
+			e.transcript.note("No code blocks found in the response")
+			prompt = e.followUpPrompt(goFiles, "", "Your previous response did not contain any fenced code blocks, so nothing was written.")
+			continue
+		}
+
+		var before WorkspaceSnapshot
+		var previous map[string]string
+		if e.config.IncludeDiff {
+			if before, err = e.takeWorkspaceSnapshot(); err != nil {
+				log.Printf("Warning: failed to snapshot workspace: %v", err)
+			}
+			previous = e.readFiles(goFiles)
+		}
+
+		written, formatErrors, err := e.writeCodeBlocks(blocks)
+		if err != nil {
+			return fmt.Errorf("failed to write generated code: %v", err)
+		}
+		log.Printf("Wrote %d file(s) to workspace: %s", len(written), strings.Join(written, ", "))
+		e.transcript.note("Wrote %d file(s): %s", len(written), strings.Join(written, ", "))
+		if len(formatErrors) > 0 {
+			log.Printf("%d Go file(s) could not be formatted and probably do not compile", len(formatErrors))
+			for path, err := range formatErrors {
+				e.transcript.note("%s could not be formatted: %v", path, err)
+			}
+		}
+		if _, err := e.writeExpectFixtures(written); err != nil {
+			log.Printf("Warning: failed to generate expected output fixtures: %v", err)
+		}
+
+		for _, path := range written {
+			if filepath.Ext(path) == ".go" {
+				goFiles[path] = true
+			}
+		}
+
+		if e.config.IncludeDiff && before.Files != nil {
+			changes = e.iterationDiff(before, previous)
+		}
+
+		if output, err := e.buildArtifact(goFiles); err != nil {
+			log.Printf("Build failed: %v", err)
+			e.transcript.note("Build failed: %v", err)
+			prompt = e.followUpPrompt(goFiles, changes, "The code failed to build:\n\n"+output)
+			continue
+		}
+		log.Println("Build succeeded")
+		e.transcript.note("Build succeeded")
+
+		var exitErr *exec.ExitError
+		if output, err := e.vetArtifact(goFiles); errors.As(err, &exitErr) {
+			log.Printf("go vet failed: %v", err)
+			e.transcript.note("go vet failed: %v", err)
+			prompt = e.followUpPrompt(goFiles, changes, "The code builds but go vet reports problems:\n\n"+output)
+			continue
+		} else if err != nil {
+			log.Printf("Warning: could not run go vet: %v", err)
+		}
+
+		output, passed, err := e.runTests()
+		if err != nil {
+			return fmt.Errorf("failed to run tests: %v", err)
+		}
+
+		// Commit whenever more tests pass than in any earlier iteration
+		if passedCount, total, ok := parseTestCounts(output); ok && passedCount > bestPassed {
+			bestPassed = passedCount
+			committer.commit(fmt.Sprintf("iteration %d: %d/%d tests passing", iteration, passedCount, total))
+		}
+		if passed {
+			log.Printf("All tests passed after %d iteration(s)", iteration)
+			e.transcript.note("All tests passed")
+			return nil
+		}
+
+		log.Println("Tests failed, asking the model for a fix")
+		e.transcript.note("Tests failed")
+		prompt = e.followUpPrompt(goFiles, changes, "The interpreter builds but some tests fail. Test runner output:\n\n"+output)
+	}
+
+	log.Printf("Tests still failing after %d iteration(s), giving up", e.config.MaxIterations)
+	return nil
+}
+
+// buildArtifact compiles the generated Go files into the target's
+// executable. The files are named explicitly because the workspace also
+// holds test_runner.go, which has its own main function.
+func (e *Engine) buildArtifact(goFiles map[string]bool) (string, error) {
+	if len(goFiles) == 0 {
+		return "no Go source files were generated", fmt.Errorf("no Go files to build")
+	}
+
+	args := []string{"build", "-o", e.config.Target.Artifact}
+	args = append(args, sortedKeys(goFiles)...)
+	return e.runGo(args...)
+}
+
+// vetArtifact runs go vet on the generated Go files, which catches mistakes
+// the compiler accepts. err is an *exec.ExitError when vet found problems.
+func (e *Engine) vetArtifact(goFiles map[string]bool) (string, error) {
+	args := append([]string{"vet"}, sortedKeys(goFiles)...)
+	return e.runGo(args...)
+}
+
+// runGo runs the go command in the workspace. The compiler and vet report
+// problems on stderr, so that is what is returned for the follow-up prompt,
+// falling back to stdout if stderr is empty.
+func (e *Engine) runGo(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Dir = e.config.WorkspaceDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if stderr.Len() == 0 {
+		return stdout.String(), err
+	}
+	return stderr.String(), err
+}
+
+// runTests runs the target's test command against the built artifact.
+// passed reports whether every test passed; err is only set when the
+// command itself could not be started.
+func (e *Engine) runTests() (output string, passed bool, err error) {
+	command := e.config.Target.TestCommand
+	if len(command) == 0 {
+		return "", false, fmt.Errorf("no test command configured for %s", e.config.Target.Name)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = e.config.WorkspaceDir
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), false, nil
+	}
+	if err != nil {
+		return string(out), false, err
+	}
+	return string(out), true, nil
+}
+
+// iterationDiff renders the changes made to the workspace since the before
+// snapshot as unified diffs. previous holds the earlier contents of files
+// the engine already knew about; modified files missing from it are listed
+// without a diff.
+func (e *Engine) iterationDiff(before WorkspaceSnapshot, previous map[string]string) string {
+	after, err := e.takeWorkspaceSnapshot()
+	if err != nil {
+		log.Printf("Warning: failed to snapshot workspace: %v", err)
+		return ""
+	}
+	report := e.generateWorkspaceReport(before, after)
+
+	var sb strings.Builder
+	changed := append(append([]string{}, report.Added...), report.Modified...)
+	sort.Strings(changed)
+	for _, path := range changed {
+		if after.Files[path].IsDir || (e.transcript != nil && path == e.transcript.name) {
+			continue
+		}
+		oldContent, known := previous[path]
+		if !known && before.Files[path].Path != "" {
+			fmt.Fprintf(&sb, "%s was modified (previous contents not available)\n", filepath.ToSlash(path))
+			continue
+		}
+		newContent, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, path))
+		if err != nil {
+			log.Printf("Warning: could not read %s: %v", path, err)
+			continue
+		}
+		sb.WriteString(unifiedDiff(filepath.ToSlash(path), oldContent, string(newContent)))
+	}
+	return sb.String()
+}
+
+// readFiles returns the contents of the given workspace files, skipping
+// any that cannot be read
+func (e *Engine) readFiles(paths map[string]bool) map[string]string {
+	contents := make(map[string]string)
+	for path := range paths {
+		data, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, path))
+		if err != nil {
+			continue
+		}
+		contents[path] = string(data)
+	}
+	return contents
+}
+
+// followUpPrompt asks the model to fix the current code given a problem
+// description. The current source files are included because each request
+// to the model is independent; changes, when set, is the diff of what the
+// previous response changed.
+func (e *Engine) followUpPrompt(goFiles map[string]bool, changes, problem string) string {
+	var sb strings.Builder
+
+	if len(goFiles) > 0 {
+		sb.WriteString("Here is the current implementation:\n\n")
+		for _, path := range sortedKeys(goFiles) {
+			content, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, path))
+			if err != nil {
+				log.Printf("Warning: could not read %s: %v", path, err)
+				continue
+			}
+			fmt.Fprintf(&sb, "```go %s\n%s```\n\n", filepath.ToSlash(path), content)
+		}
+	}
+
+	if changes != "" {
+		sb.WriteString("Your previous response made these changes:\n\n```diff\n")
+		sb.WriteString(changes)
+		sb.WriteString("```\n\n")
+	}
+
+	sb.WriteString(problem)
+	sb.WriteString("\n\nPlease fix the problems and provide the complete contents of every file you change.\n")
+	sb.WriteString("Put each file in its own fenced code block with the filename after the language, for example ```go main.go.")
+	return sb.String()
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// systemPrompt gives the model the same persona for every request
+func (e *Engine) systemPrompt() string {
+	target := e.config.Target
+	return fmt.Sprintf("You are an expert Go developer building %s %s. You write complete, correct, idiomatic Go.\n", target.Article(), target.Name) +
+		"When you provide code, put each file in its own fenced code block with the filename after the language, for example ```go main.go."
+}
+
+// show prints a complete response between the console markers
+func (e *Engine) show(title, response string) {
+	log.Printf("=== LLM %s ===", title)
+	fmt.Fprintln(e.console(), response)
+	log.Printf("=== End %s ===", title)
+}
+
+// generateStream sends req and prints the response text to the console
+// as it arrives. The opening marker is only printed once the first text
+// arrives, so a request that fails outright prints nothing. A response cut
+// short by the configured limits is returned as far as it got, with
+// truncated set.
+func (e *Engine) generateStream(generator StreamingGenerator, req GenerateRequest, title string) (response GenerateResponse, truncated bool, err error) {
+	limits, _ := e.config.streamLimits() // validated by loadConfig
+	console := e.console()
+	started := false
+	response, truncated, err = DoStreamLimited(context.Background(), generator, req, limits, func(chunk string) error {
+		if !started {
+			log.Printf("=== LLM %s ===", title)
+			started = true
+		}
+		_, err := io.WriteString(console, chunk)
+		return err
+	})
+	if started {
+		fmt.Fprintln(console)
+		log.Printf("=== End %s ===", title)
+	}
+	if truncated {
+		log.Printf("%s response truncated at %d characters by the response limits", title, len(response.Response))
+	}
+	return response, truncated, err
+}
+
+// console is where responses are printed, standard output unless a test
+// has substituted a buffer
+func (e *Engine) console() io.Writer {
+	if e.output == nil {
+		return os.Stdout
+	}
+	return e.output
+}
+
+// errTokenBudget is returned by generate once the session's token budget
+// has been used up
+var errTokenBudget = errors.New("token budget exhausted")
+
+// generate sends a prompt to the model, continuing the conversation of the
+// previous generation and counting the response tokens against the
+// session's token budget when the generator supports it. The response is
+// printed to the console between "=== LLM <title> ===" markers, as it
+// arrives if the generator can stream.
+func (e *Engine) generate(prompt, title string) (string, error) {
+	if e.config.TokenBudget > 0 && e.tokensUsed >= e.config.TokenBudget {
+		return "", fmt.Errorf("%w (%d of %d tokens used)", errTokenBudget, e.tokensUsed, e.config.TokenBudget)
+	}
+
+	generator, ok := e.generator.(RequestGenerator)
+	if !ok {
+		start := time.Now()
+		response, err := e.generator.Generate(e.config.ModelName, e.systemPrompt()+"\n\n"+prompt)
+		e.transcript.generation(prompt, response, time.Since(start), err)
+		if err == nil {
+			e.show(title, response)
+		}
+		return response, err
+	}
+
+	req := GenerateRequest{
+		Model:   e.config.ModelName,
+		System:  e.systemPrompt(),
+		Prompt:  prompt,
+		Context: e.conversation,
+	}
+	start := time.Now()
+	var response GenerateResponse
+	var truncated bool
+	var err error
+	if streamer, ok := generator.(StreamingGenerator); ok {
+		response, truncated, err = e.generateStream(streamer, req, title)
+	} else {
+		response, err = generator.Do(context.Background(), req)
+		if err == nil {
+			e.show(title, response.Response)
+		}
+	}
+	e.transcript.generation(prompt, response.Response, time.Since(start), err)
+	e.tokensUsed += response.EvalCount
+	if err == nil && !truncated {
+		// A truncated response has no context, so keep the conversation so far
+		e.conversation = response.Context
+	}
+	if e.config.TokenBudget > 0 {
+		log.Printf("Tokens used: %d of %d", e.tokensUsed, e.config.TokenBudget)
+	} else {
+		log.Printf("Tokens used: %d", e.tokensUsed)
+	}
+	return response.Response, err
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeGenerator returns its responses in turn and records the prompts it
+// was given
+type fakeGenerator struct {
+	responses []string
+	prompts   []string
+}
+
+func (g *fakeGenerator) Generate(model, prompt string) (string, error) {
+	g.prompts = append(g.prompts, prompt)
+	if len(g.prompts) > len(g.responses) {
+		return "", fmt.Errorf("no response left for prompt %d", len(g.prompts))
+	}
+	return g.responses[len(g.prompts)-1], nil
+}
+
+// fakeRequestGenerator is a fakeGenerator that also takes full requests,
+// recording them. Each response reports evalCount tokens and has the
+// context [n] for the nth request.
+type fakeRequestGenerator struct {
+	fakeGenerator
+	evalCount int
+	requests  []GenerateRequest
+}
+
+func (g *fakeRequestGenerator) Do(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	g.requests = append(g.requests, req)
+	text, err := g.Generate(req.Model, req.Prompt)
+	return GenerateResponse{Model: req.Model, Response: text, Done: true, Context: []int{len(g.requests)}, EvalCount: g.evalCount}, err
+}
+
+// goProgram is a response holding a main.go with the given body for main
+func goProgram(body string) string {
+	return "```go main.go\npackage main\n\nimport \"os\"\n\nvar _ = os.Exit\n\nfunc main() {\n" + body + "\n}\n```\n"
+}
+
+// newIteratingEngine returns an engine whose target is a Go program that
+// passes its tests by exiting with status 0
+func newIteratingEngine(t *testing.T, generator Generator, maxIterations int) *Engine {
+	e := newTestEngine(t)
+	e.config.MaxIterations = maxIterations
+	e.config.Target = Target{Name: "tool", Artifact: "tool", TestCommand: []string{"./tool"}}
+	e.generator = generator
+	e.output = &bytes.Buffer{}
+	return e
+}
+
+func TestDevelopIterativelyFeedsBackFailures(t *testing.T) {
+	generator := &fakeGenerator{responses: []string{
+		goProgram("\tundefinedFunction()"),
+		goProgram("\tos.Exit(1)"),
+		goProgram(""),
+		goProgram("\tpanic(\"not reached\")"),
+	}}
+	e := newIteratingEngine(t, generator, 5)
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 3 {
+		t.Fatalf("%d generations, want 3 ending with the passing one", len(generator.prompts))
+	}
+	if !strings.Contains(generator.prompts[1], "The code failed to build") || !strings.Contains(generator.prompts[1], "undefinedFunction") {
+		t.Errorf("second prompt does not report the build failure:\n%s", generator.prompts[1])
+	}
+	if !strings.Contains(generator.prompts[2], "some tests fail") || !strings.Contains(generator.prompts[2], "os.Exit(1)") {
+		t.Errorf("third prompt does not report the test failure with the current code:\n%s", generator.prompts[2])
+	}
+}
+
+func TestDevelopIterativelyGivesUp(t *testing.T) {
+	generator := &fakeGenerator{responses: []string{"no code", "still no code", "never asked for"}}
+	e := newIteratingEngine(t, generator, 2)
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 2 {
+		t.Errorf("%d generations, want MaxIterations = 2", len(generator.prompts))
+	}
+	if !strings.Contains(generator.prompts[1], "did not contain any fenced code blocks") {
+		t.Errorf("second prompt does not say the response had no code:\n%s", generator.prompts[1])
+	}
+}
+
+func TestFixPromptIncludesDiff(t *testing.T) {
+	generator := &fakeGenerator{responses: []string{
+		goProgram("\tos.Exit(1)"),
+		goProgram("\tos.Exit(2)"),
+		goProgram(""),
+	}}
+	e := newIteratingEngine(t, generator, 3)
+	e.config.IncludeDiff = true
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 3 {
+		t.Fatalf("%d generations, want 3", len(generator.prompts))
+	}
+	prompt := generator.prompts[2]
+	for _, want := range []string{"Your previous response made these changes", "--- a/main.go", "-\tos.Exit(1)\n", "+\tos.Exit(2)\n"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("fix prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestTokenBudgetStopsSession(t *testing.T) {
+	logged := captureLog(t)
+	generator := &fakeRequestGenerator{
+		fakeGenerator: fakeGenerator{responses: []string{"no code", "no code", "no code", "no code", "no code"}},
+		evalCount:     100,
+	}
+	e := newIteratingEngine(t, generator, 5)
+	e.config.TokenBudget = 250
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 3 {
+		t.Errorf("%d generations, want 3 to exceed a budget of 250 at 100 tokens each", len(generator.prompts))
+	}
+	if e.tokensUsed != 300 {
+		t.Errorf("%d tokens used, want 300", e.tokensUsed)
+	}
+	if want := "Stopping: token budget exhausted (300 of 250 tokens used)"; !strings.Contains(logged.String(), want) {
+		t.Errorf("log lacks %q:\n%s", want, logged)
+	}
+}
+
+func TestConversationThreadsThroughIterations(t *testing.T) {
+	captureLog(t)
+	generator := &fakeRequestGenerator{fakeGenerator: fakeGenerator{responses: []string{"no code", "no code", "no code"}}}
+	e := newIteratingEngine(t, generator, 3)
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.requests) != 3 {
+		t.Fatalf("%d requests, want 3", len(generator.requests))
+	}
+	for i, req := range generator.requests {
+		var want []int
+		if i > 0 {
+			want = []int{i}
+		}
+		if !reflect.DeepEqual(req.Context, want) {
+			t.Errorf("request %d sent context %v, want %v", i+1, req.Context, want)
+		}
+		if req.System != e.systemPrompt() {
+			t.Errorf("request %d sent system prompt %q", i+1, req.System)
+		}
+	}
+}
+
+func TestCompileAndVetErrorsFedBack(t *testing.T) {
+	captureLog(t)
+	generator := &fakeGenerator{responses: []string{
+		goProgram("\tvar unused int"),
+		goProgram("\treturn\n\tprintln(\"unreachable\")"),
+		goProgram(""),
+	}}
+	e := newIteratingEngine(t, generator, 3)
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 3 {
+		t.Fatalf("%d generations, want 3", len(generator.prompts))
+	}
+	if prompt := generator.prompts[1]; !strings.Contains(prompt, "The code failed to build:") || !strings.Contains(prompt, "declared and not used: unused") {
+		t.Errorf("second prompt lacks the compiler error:\n%s", prompt)
+	}
+	if prompt := generator.prompts[2]; !strings.Contains(prompt, "go vet reports problems:") || !strings.Contains(prompt, "unreachable code") {
+		t.Errorf("third prompt lacks the vet report:\n%s", prompt)
+	}
+}
+
+// chunkWriter records each write separately, to show streamed output
+// arriving a piece at a time
+type chunkWriter struct {
+	writes []string
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestGenerateStreamsToConsole(t *testing.T) {
+	logged := captureLog(t)
+	server := httptest.NewServer(streamHandler(7, "Looks ", "mostly ", "fine."))
+	defer server.Close()
+	client := NewOllamaClient(serverAddr(server))
+	e := newTestEngine(t)
+	e.generator = client
+	console := &chunkWriter{}
+	e.output = console
+
+	response, err := e.generate("analyze", "Analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Looks mostly fine." {
+		t.Errorf("response %q, want the accumulated chunks", response)
+	}
+	if want := []string{"Looks ", "mostly ", "fine.", "\n"}; !reflect.DeepEqual(console.writes, want) {
+		t.Errorf("console writes %q, want %q", console.writes, want)
+	}
+	if !reflect.DeepEqual(e.conversation, []int{1, 2}) || e.tokensUsed != 7 {
+		t.Errorf("conversation %v and %d tokens, want the final response's", e.conversation, e.tokensUsed)
+	}
+
+	start, end := strings.Index(logged.String(), "=== LLM Analysis ==="), strings.Index(logged.String(), "=== End Analysis ===")
+	if start < 0 || end < start {
+		t.Errorf("response not framed by the LLM markers:\n%s", logged)
+	}
+}
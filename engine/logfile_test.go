@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLogFileRecordsRun(t *testing.T) {
+	logged := captureLog(t)
+	path := filepath.Join(t.TempDir(), "engine.log")
+	logFile, err := openRotatingFile(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(io.MultiWriter(logged, logFile))
+
+	generator := &fakeGenerator{responses: []string{"no code"}}
+	if err := newIteratingEngine(t, generator, 1).developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	if err := logFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != logged.String() {
+		t.Errorf("log file differs from the console log:\n%s", content)
+	}
+	timestamped := regexp.MustCompile(`(?m)^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d === Iteration 1 of 1 ===$`)
+	if !timestamped.Match(content) || !strings.Contains(string(content), "No code blocks found in LLM response") {
+		t.Errorf("log file lacks the run's timestamped messages:\n%s", content)
+	}
+}
+
+func TestLogFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.log")
+	logFile, err := openRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(logFile, "line %d %s\n", i, strings.Repeat("x", 30))
+	}
+	if err := logFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each file holds two 38-byte lines, and only two backups are kept
+	for suffix, want := range map[string]string{"": "line 8", ".1": "line 6", ".2": "line 4"} {
+		content, err := os.ReadFile(path + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > 100 || !strings.HasPrefix(string(content), want) || strings.Count(string(content), "\n") != 2 {
+			t.Errorf("engine.log%s holds %q, want two lines starting at %s", suffix, content, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept a third backup")
+	}
+
+	// Reopening appends to the current file
+	if logFile, err = openRotatingFile(path, 100, 2); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(logFile, "reopened")
+	logFile.Close()
+	if content, _ := os.ReadFile(path); !strings.HasPrefix(string(content), "line 8") || !strings.HasSuffix(string(content), "\nreopened\n") {
+		t.Errorf("reopening did not append to the current file: engine.log holds %q", content)
+	}
+}
+
+// TestMainHelper is not a real test: TestFailureReachesLogFile runs it as
+// the engine, with the arguments in ENGINE_TEST_ARGS
+func TestMainHelper(t *testing.T) {
+	if os.Getenv("ENGINE_TEST_MAIN") != "1" {
+		return
+	}
+	os.Args = append([]string{"engine"}, strings.Split(os.Getenv("ENGINE_TEST_ARGS"), "\n")...)
+	main()
+	os.Exit(0)
+}
+
+func TestFailureReachesLogFile(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := server.Listener.Addr().String()
+	server.Close()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "engine.log")
+	config := fmt.Sprintf(`{"ollama_server": %q, "workspace_dir": %q, "log_file": %q}`, addr, filepath.Join(dir, "workspace"), logPath)
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainHelper$")
+	cmd.Env = append(os.Environ(), "ENGINE_TEST_MAIN=1", "ENGINE_TEST_ARGS=-config\n"+configPath)
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("got %v, want exit status 1:\n%s", err, output)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "Engine failed: cannot reach Ollama") {
+		t.Errorf("log file lacks the failure:\n%s", content)
+	}
+}
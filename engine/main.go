@@ -1,23 +1,70 @@
 package main
 
 import (
-	"crypto/md5"
+	"bufio"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Config holds the engine configuration
 type Config struct {
-	OllamaServer string `json:"ollama_server"`
-	ModelName    string `json:"model_name"`
-	WorkspaceDir string `json:"workspace_dir"`
+	OllamaServer  string   `json:"ollama_server"`
+	OllamaServers []string `json:"ollama_servers"` // optional failover list, tried in order
+	OllamaScheme  string   `json:"ollama_scheme"`  // "http" (default) or "https"
+	ModelName     string   `json:"model_name"`
+	WorkspaceDir  string   `json:"workspace_dir"`
+	MaxIterations int      `json:"max_iterations"`
+	IncludeDiff   bool     `json:"include_diff"` // show the model a diff of its previous changes in fix prompts
+	DumpDir       string   `json:"dump_dir"`     // dump the first generate call's request and response JSON here
+	TokenBudget   int      `json:"token_budget"` // stop once this many response tokens are generated; 0 means no limit
+	MaxConcurrent int      `json:"max_concurrent_requests"`
+	KeepAlive     string   `json:"keep_alive"` // how long Ollama keeps the model loaded between requests, e.g. "10m"
+	GitCommit     bool     `json:"git_commit"` // commit the workspace after each iteration that passes more tests
+
+	// gitignore-style globs left out of snapshots and scans, on top of the defaults
+	IgnorePatterns []string `json:"ignore_patterns"`
+
+	// List files whose mod time changed but content did not in the report
+	ReportTouched bool `json:"report_touched"`
+
+	// Also write the log here, rotating when the file reaches LogMaxBytes
+	// (default 10 MiB) and keeping LogBackups (default 3) old files
+	LogFile     string `json:"log_file"`
+	LogMaxBytes int64  `json:"log_max_bytes"`
+	LogBackups  int    `json:"log_backups"`
+
+	// Longest rendered fresh or analyze prompt, in characters; the workspace
+	// listing is cut down to fit. 0 means no limit.
+	MaxPromptChars int `json:"max_prompt_chars"`
+
+	// Cut a streamed response short at this many characters or after this
+	// long, e.g. "15m". 0 and "" mean no limit.
+	MaxResponseBytes int    `json:"max_response_bytes"`
+	MaxResponseTime  string `json:"max_response_time"`
+
+	// Algorithm for snapshot file hashes: "md5" (default), "sha256" or "crc32"
+	HashAlgorithm string `json:"hash_algorithm"`
+
+	// Snapshot file reports are made against, kept across runs; taken on first use
+	BaselinePath string `json:"baseline_path"`
+
+	// Optional text/template files replacing the built-in prompts
+	FreshPromptPath   string `json:"fresh_prompt_path"`
+	AnalyzePromptPath string `json:"analyze_prompt_path"`
+
+	// The project to develop; fields left unset keep the BASIC defaults
+	Target Target `json:"target"`
 }
 
 // FileInfo represents information about a file
@@ -31,8 +78,9 @@ type FileInfo struct {
 
 // WorkspaceSnapshot represents the state of the workspace at a point in time
 type WorkspaceSnapshot struct {
-	Timestamp time.Time            `json:"timestamp"`
-	Files     map[string]FileInfo  `json:"files"`
+	Timestamp     time.Time           `json:"timestamp"`
+	HashAlgorithm string              `json:"hash_algorithm"` // how the file hashes were computed
+	Files         map[string]FileInfo `json:"files"`
 }
 
 // WorkspaceReport compares before and after snapshots
@@ -42,39 +90,64 @@ type WorkspaceReport struct {
 	Added    []string          `json:"added"`
 	Removed  []string          `json:"removed"`
 	Modified []string          `json:"modified"`
+	Touched  []string          `json:"touched,omitempty"` // only filled in when report_touched is set
 	Summary  string            `json:"summary"`
 }
 
 // Engine represents the LLM agent engine
 type Engine struct {
-	config *Config
-	client *OllamaClient
+	config    *Config
+	models    ModelManager
+	generator Generator
+
+	tokensUsed   int         // response tokens generated so far this session
+	conversation []int       // Ollama context from the last generation, continued by the next
+	transcript   *transcript // prompts and responses of this run, nil if it could not be created
+	output       io.Writer   // where responses are printed; nil means standard output
 }
 
-// NewEngine creates a new engine instance
-func NewEngine() (*Engine, error) {
-	config, err := loadConfig()
+// NewEngine creates a new engine instance for config
+func NewEngine(config *Config) (*Engine, error) {
+	log.Printf("Loaded config: Ollama=%s, Model=%s, Workspace=%s, Target=%s",
+		strings.Join(config.servers(), ","), config.ModelName, config.WorkspaceDir, config.Target.Name)
+
+	var opts []ClientOption
+	if config.OllamaScheme != "" {
+		opts = append(opts, WithScheme(config.OllamaScheme))
+	}
+	if config.MaxConcurrent > 0 {
+		opts = append(opts, WithMaxConcurrent(config.MaxConcurrent))
+	}
+	if config.KeepAlive != "" {
+		opts = append(opts, WithKeepAlive(config.KeepAlive))
+	}
+	client, err := NewOllamaClientWithOptions(config.servers(), opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %v", err)
+		return nil, fmt.Errorf("invalid Ollama configuration: %v", err)
+	}
+	if config.DumpDir != "" {
+		client.DumpNextRequest(config.DumpDir)
 	}
-
-	client := NewOllamaClient(config.OllamaServer)
 
 	return &Engine{
-		config: config,
-		client: client,
+		config:    config,
+		models:    client,
+		generator: client,
 	}, nil
 }
 
-// loadConfig reads configuration from config.json with defaults
-func loadConfig() (*Config, error) {
+// loadConfig reads configuration from configPath with defaults
+func loadConfig(configPath string) (*Config, error) {
 	config := &Config{
-		OllamaServer: "192.168.0.63:11434",
-		ModelName:    "qwen3:30b",
-		WorkspaceDir: "/workspace",
+		OllamaServer:   "192.168.0.63:11434",
+		ModelName:      "qwen3:30b",
+		WorkspaceDir:   "/workspace",
+		MaxIterations:  5,
+		HashAlgorithm:  defaultHashAlgorithm,
+		MaxPromptChars: 24000,
+		Target:         defaultTarget(),
 	}
 
-	configPath := "config.json"
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Printf("Config file %s not found, using defaults", configPath)
 		return config, nil
@@ -88,14 +161,28 @@ func loadConfig() (*Config, error) {
 	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
-
-	log.Printf("Loaded config: Ollama=%s, Model=%s, Workspace=%s", 
-		config.OllamaServer, config.ModelName, config.WorkspaceDir)
+	if config.MaxIterations < 1 {
+		config.MaxIterations = 1
+	}
+	if _, err := newHash(config.HashAlgorithm); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if _, err := config.streamLimits(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
 
 	return config, nil
 }
 
-// Run starts the engine and begins the BASIC interpreter development session
+// servers returns the Ollama servers to use, preferring the failover list
+func (c *Config) servers() []string {
+	if len(c.OllamaServers) > 0 {
+		return c.OllamaServers
+	}
+	return []string{c.OllamaServer}
+}
+
+// Run starts the engine and begins the development session for the target
 func (e *Engine) Run() error {
 	log.Println("Starting LLM Agent Engine...")
 	
@@ -105,21 +192,44 @@ func (e *Engine) Run() error {
 	}
 
 	// Check if we can connect to Ollama
-	log.Printf("Connecting to Ollama server at %s...", e.config.OllamaServer)
-	if err := e.client.HealthCheck(); err != nil {
-		return fmt.Errorf("failed to connect to Ollama server at %s: %v", e.config.OllamaServer, err)
+	servers := strings.Join(e.config.servers(), ", ")
+	log.Printf("Connecting to Ollama server at %s...", servers)
+	version, err := e.models.Version()
+	if errors.Is(err, ErrConnection) {
+		return fmt.Errorf("cannot reach Ollama at %s (is Ollama running and the address correct?): %v", servers, err)
+	} else if err != nil {
+		return fmt.Errorf("Ollama at %s responded but is not healthy (check the server logs): %v", servers, err)
+	}
+	log.Printf("Successfully connected to Ollama server (version %s)", version)
+
+	// Download the model if the server does not have it yet
+	if err := e.ensureModel(); err != nil {
+		return fmt.Errorf("model %s is not available: %v", e.config.ModelName, err)
 	}
-	log.Println("Successfully connected to Ollama server")
 
 	// Take a snapshot before starting
 	log.Println("Creating workspace snapshot before engine run...")
-	beforeSnapshot, err := e.takeWorkspaceSnapshot()
+	beforeSnapshot, err := e.baselineSnapshot()
 	if err != nil {
 		return fmt.Errorf("failed to create before snapshot: %v", err)
 	}
 
+	// Record prompts and responses for later review
+	start := time.Now()
+	if e.transcript, err = newTranscript(e.config.WorkspaceDir, e.config.ModelName, start); err != nil {
+		log.Printf("Warning: failed to create transcript: %v", err)
+	} else {
+		log.Printf("Writing transcript to %s", e.transcript.name)
+	}
+
 	// Start the development session
 	err = e.startDevelopmentSession()
+	log.Printf("Total tokens generated this session: %d", e.tokensUsed)
+	if err != nil {
+		e.transcript.note("Session failed: %v", err)
+	}
+	e.transcript.note("Total tokens generated: %d", e.tokensUsed)
+	e.transcript.close(start)
 
 	// Take a snapshot after completion (regardless of success/failure)
 	log.Println("Creating workspace snapshot after engine run...")
@@ -139,120 +249,140 @@ func (e *Engine) Run() error {
 	return err
 }
 
+// ensureModel pulls the configured model if the server does not list it
+func (e *Engine) ensureModel() error {
+	models, err := e.models.ListModels()
+	if err != nil {
+		return err
+	}
+
+	want := e.config.ModelName
+	if !strings.Contains(want, ":") {
+		want += ":latest"
+	}
+	for _, model := range models {
+		if model == want {
+			return nil
+		}
+	}
+
+	log.Printf("Model %s not found on server, pulling it...", e.config.ModelName)
+	lastStatus, lastPercent := "", -1
+	return e.models.PullModel(e.config.ModelName, func(status string, completed, total int64) {
+		if status != lastStatus {
+			log.Printf("Pull: %s", status)
+			lastStatus, lastPercent = status, -1
+		}
+		if total > 0 {
+			// Log download progress in 10% steps
+			if percent := int(completed * 100 / total); percent/10 > lastPercent/10 {
+				log.Printf("Pull: %d%% of %d bytes", percent, total)
+				lastPercent = percent
+			}
+		}
+	})
+}
+
 // startDevelopmentSession begins the interactive development process
 func (e *Engine) startDevelopmentSession() error {
-	log.Println("Starting BASIC interpreter development session...")
+	target := e.config.Target
+	log.Printf("Starting %s development session...", target.Name)
 
-	// Check if BASIC interpreter already exists
-	basicPath := filepath.Join(e.config.WorkspaceDir, "basic")
+	// Check if the target has already been built
+	artifactPath := filepath.Join(e.config.WorkspaceDir, target.Artifact)
 
-	if _, err := os.Stat(basicPath); err == nil {
-		log.Println("BASIC interpreter already exists, analyzing current state...")
+	if _, err := os.Stat(artifactPath); err == nil {
+		log.Printf("%s already exists at %s, analyzing current state...", target.Name, target.Artifact)
 		return e.analyzeExistingCode()
 	}
 
-	log.Println("No BASIC interpreter found, starting fresh development...")
+	log.Printf("No %s found, starting fresh development...", target.Name)
 	return e.startFreshDevelopment()
 }
 
 // analyzeExistingCode examines the current workspace and suggests improvements
 func (e *Engine) analyzeExistingCode() error {
-	// Read the current workspace state
-	workspaceFiles, err := e.scanWorkspace()
+	prompt, err := e.renderPrompt(e.config.AnalyzePromptPath, defaultAnalyzePrompt)
 	if err != nil {
-		return fmt.Errorf("failed to scan workspace: %v", err)
+		return err
 	}
 
-	prompt := fmt.Sprintf(`You are an expert software developer assistant. I have a workspace with a BASIC interpreter implementation. Please analyze the current state and suggest next steps for improvement.
-
-Current workspace files:
-%s
-
-The goal is to have a complete, well-tested BASIC interpreter. Please:
-1. Analyze the current implementation
-2. Identify any gaps or areas for improvement  
-3. Suggest specific next steps
-4. Prioritize the most important improvements
-
-Please be specific and actionable in your suggestions.`, workspaceFiles)
-
-	response, err := e.client.Generate(e.config.ModelName, prompt)
-	if err != nil {
+	e.transcript.section("Analysis")
+	if _, err := e.generate(prompt, "Analysis"); err != nil {
 		return fmt.Errorf("failed to get LLM response: %v", err)
 	}
 
-	log.Println("=== LLM Analysis ===")
-	fmt.Println(response)
-	log.Println("=== End Analysis ===")
-
 	return nil
 }
 
-// startFreshDevelopment begins developing a BASIC interpreter from scratch
+// startFreshDevelopment begins developing the target from scratch
 func (e *Engine) startFreshDevelopment() error {
-	prompt := `You are an expert software developer. Your task is to implement a BASIC interpreter in Go with the following requirements:
-
-1. Support line-numbered BASIC syntax (classic style)
-2. Implement core statements: PRINT, LET, GOTO, IF-THEN, FOR-NEXT, REM, END
-3. Support variables (both numeric and string)
-4. Include proper error handling
-5. Accept filename as command line argument
-
-The interpreter should be compatible with test files that exist in tests/basic/ directory.
-
-Please provide a complete Go implementation of the BASIC interpreter. Focus on correctness and clarity.`
-
-	response, err := e.client.Generate(e.config.ModelName, prompt)
+	prompt, err := e.renderPrompt(e.config.FreshPromptPath, defaultFreshPrompt)
 	if err != nil {
-		return fmt.Errorf("failed to get LLM response: %v", err)
+		return err
 	}
 
-	log.Println("=== LLM Generated Code ===")
-	fmt.Println(response)
-	log.Println("=== End Generated Code ===")
+	return e.developIteratively(prompt)
+}
 
-	// TODO: Parse the response and extract code to write to files
-	// TODO: Run tests to verify the generated code
-	// TODO: Iterate on improvements
+// workspaceEntry is one line of the workspace listing
+type workspaceEntry struct {
+	path    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
 
-	return nil
+func (w workspaceEntry) String() string {
+	if w.isDir {
+		return fmt.Sprintf("📁 %s/\n", w.path)
+	}
+	return fmt.Sprintf("📄 %s (%d bytes)\n", w.path, w.size)
 }
 
 // scanWorkspace reads the current workspace structure
-func (e *Engine) scanWorkspace() (string, error) {
-	var result string
+func (e *Engine) scanWorkspace() ([]workspaceEntry, error) {
+	var entries []workspaceEntry
+	ignore := newIgnoreMatcher(e.config.IgnorePatterns)
 
 	err := filepath.Walk(e.config.WorkspaceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip hidden files and directories
-		if filepath.Base(path)[0] == '.' {
+		relPath, _ := filepath.Rel(e.config.WorkspaceDir, path)
+		if relPath == "." {
 			return nil
 		}
 
-		relPath, _ := filepath.Rel(e.config.WorkspaceDir, path)
-		if info.IsDir() {
-			result += fmt.Sprintf("📁 %s/\n", relPath)
-		} else {
-			size := info.Size()
-			result += fmt.Sprintf("📄 %s (%d bytes)\n", relPath, size)
+		// Skip hidden and ignored files and directories
+		if ignore.ignored(relPath, info.IsDir()) {
+			return skipEntry(info)
 		}
 
+		entries = append(entries, workspaceEntry{
+			path:    relPath,
+			isDir:   info.IsDir(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
 		return nil
 	})
 
-	return result, err
+	return entries, err
 }
 
-// takeWorkspaceSnapshot creates a snapshot of the current workspace state
+// takeWorkspaceSnapshot creates a snapshot of the current workspace state.
+// The tree is walked first and the files are then hashed in parallel.
 func (e *Engine) takeWorkspaceSnapshot() (WorkspaceSnapshot, error) {
 	snapshot := WorkspaceSnapshot{
-		Timestamp: time.Now(),
-		Files:     make(map[string]FileInfo),
+		Timestamp:     time.Now(),
+		HashAlgorithm: e.hashAlgorithm(),
+		Files:         make(map[string]FileInfo),
 	}
 
+	var toHash []string
+	ignore := newIgnoreMatcher(e.config.IgnorePatterns)
 	err := filepath.Walk(e.config.WorkspaceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -264,12 +394,16 @@ func (e *Engine) takeWorkspaceSnapshot() (WorkspaceSnapshot, error) {
 			return err
 		}
 
-		// Skip hidden files and directories
-		if strings.HasPrefix(filepath.Base(relPath), ".") {
+		if relPath == "." {
 			return nil
 		}
 
-		fileInfo := FileInfo{
+		// Skip hidden and ignored files and directories
+		if ignore.ignored(relPath, info.IsDir()) {
+			return skipEntry(info)
+		}
+
+		snapshot.Files[relPath] = FileInfo{
 			Path:    relPath,
 			Size:    info.Size(),
 			ModTime: info.ModTime(),
@@ -278,30 +412,85 @@ func (e *Engine) takeWorkspaceSnapshot() (WorkspaceSnapshot, error) {
 
 		// Calculate hash for files (not directories)
 		if !info.IsDir() {
-			hash, err := e.calculateFileHash(path)
-			if err != nil {
-				log.Printf("Warning: failed to hash file %s: %v", relPath, err)
-				hash = ""
-			}
-			fileInfo.Hash = hash
+			toHash = append(toHash, relPath)
 		}
-
-		snapshot.Files[relPath] = fileInfo
 		return nil
 	})
+	if err != nil {
+		return snapshot, err
+	}
 
-	return snapshot, err
+	for relPath, hash := range e.hashFiles(toHash) {
+		fileInfo := snapshot.Files[relPath]
+		fileInfo.Hash = hash
+		snapshot.Files[relPath] = fileInfo
+	}
+	return snapshot, nil
 }
 
-// calculateFileHash computes MD5 hash of a file
+// skipEntry is what a walk function returns to leave out an entry, along
+// with everything under it if it is a directory
+func skipEntry(info os.FileInfo) error {
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// hashFiles hashes the workspace files at relPaths using a pool of
+// GOMAXPROCS workers. Files that cannot be read are logged and given an
+// empty hash.
+func (e *Engine) hashFiles(relPaths []string) map[string]string {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(relPaths) {
+		workers = len(relPaths)
+	}
+
+	hashes := make(map[string]string, len(relPaths))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	paths := make(chan string)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for relPath := range paths {
+				hash, err := e.calculateFileHash(filepath.Join(e.config.WorkspaceDir, relPath))
+				if err != nil {
+					log.Printf("Warning: failed to hash file %s: %v", relPath, err)
+					hash = ""
+				}
+				mu.Lock()
+				hashes[relPath] = hash
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, relPath := range relPaths {
+		paths <- relPath
+	}
+	close(paths)
+	wg.Wait()
+
+	return hashes
+}
+
+// calculateFileHash computes the hash of a file with the configured
+// algorithm
 func (e *Engine) calculateFileHash(filePath string) (string, error) {
+	hash, err := newHash(e.config.HashAlgorithm)
+	if err != nil {
+		return "", err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hash := md5.New()
 	if _, err := io.Copy(hash, file); err != nil {
 		return "", err
 	}
@@ -340,6 +529,10 @@ func (e *Engine) generateWorkspaceReport(before, after WorkspaceSnapshot) Worksp
 			if !afterFile.IsDir && !beforeFile.IsDir {
 				if afterFile.Hash != beforeFile.Hash {
 					report.Modified = append(report.Modified, path)
+				} else if e.config.ReportTouched && afterFile.Hash != "" && !afterFile.ModTime.Equal(beforeFile.ModTime) {
+					// Same content but a new mod time; unreadable files are
+					// left out because their content is unknown
+					report.Touched = append(report.Touched, path)
 				}
 			}
 		}
@@ -349,6 +542,7 @@ func (e *Engine) generateWorkspaceReport(before, after WorkspaceSnapshot) Worksp
 	sort.Strings(report.Added)
 	sort.Strings(report.Removed)
 	sort.Strings(report.Modified)
+	sort.Strings(report.Touched)
 
 	// Generate summary
 	report.Summary = e.generateSummary(report)
@@ -367,6 +561,9 @@ func (e *Engine) generateSummary(report WorkspaceReport) string {
 	summary.WriteString(fmt.Sprintf("- Files added: %d\n", len(report.Added)))
 	summary.WriteString(fmt.Sprintf("- Files removed: %d\n", len(report.Removed)))
 	summary.WriteString(fmt.Sprintf("- Files modified: %d\n", len(report.Modified)))
+	if e.config.ReportTouched {
+		summary.WriteString(fmt.Sprintf("- Files touched without changes: %d\n", len(report.Touched)))
+	}
 	
 	if len(report.Added) > 0 {
 		summary.WriteString("\nAdded files:\n")
@@ -392,20 +589,30 @@ func (e *Engine) generateSummary(report WorkspaceReport) string {
 		}
 	}
 	
+	if len(report.Touched) > 0 {
+		summary.WriteString("\nTouched files (content unchanged):\n")
+		for _, file := range report.Touched {
+			summary.WriteString(fmt.Sprintf("  = %s\n", file))
+		}
+	}
+
 	return summary.String()
 }
 
 // saveWorkspaceReport saves the workspace report to a JSON file
 func (e *Engine) saveWorkspaceReport(report WorkspaceReport) error {
 	reportPath := filepath.Join(e.config.WorkspaceDir, "workspace-report.json")
-	
-	// Pretty print JSON
-	jsonData, err := json.MarshalIndent(report, "", "  ")
+
+	// Stream the JSON so large snapshots are never encoded in memory at once
+	file, err := os.Create(reportPath)
 	if err != nil {
-		return fmt.Errorf("failed to marshal report: %v", err)
+		return fmt.Errorf("failed to create report file: %v", err)
 	}
-	
-	if err := os.WriteFile(reportPath, jsonData, 0644); err != nil {
+	if err := writeReportJSON(file, report); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write report file: %v", err)
+	}
+	if err := file.Close(); err != nil {
 		return fmt.Errorf("failed to write report file: %v", err)
 	}
 	
@@ -425,13 +632,176 @@ func (e *Engine) saveWorkspaceReport(report WorkspaceReport) error {
 	return nil
 }
 
+// reportWriter writes indented JSON piece by piece, remembering the first
+// error so callers can check once at the end
+type reportWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (rw *reportWriter) raw(text string) {
+	if rw.err == nil {
+		_, rw.err = rw.w.WriteString(text)
+	}
+}
+
+// field writes "name": value with value indented to the given depth
+func (rw *reportWriter) field(indent, name string, value interface{}) {
+	if rw.err != nil {
+		return
+	}
+	key, err := json.Marshal(name)
+	if err != nil {
+		rw.err = err
+		return
+	}
+	data, err := json.MarshalIndent(value, indent, "  ")
+	if err != nil {
+		rw.err = err
+		return
+	}
+	rw.raw(indent + string(key) + ": " + string(data))
+}
+
+// snapshot writes a WorkspaceSnapshot field, encoding one file at a time
+func (rw *reportWriter) snapshot(indent, name string, snapshot WorkspaceSnapshot) {
+	inner := indent + "  "
+	rw.raw(indent + `"` + name + `": {` + "\n")
+	rw.field(inner, "timestamp", snapshot.Timestamp)
+	rw.raw(",\n")
+	rw.field(inner, "hash_algorithm", snapshot.HashAlgorithm)
+	rw.raw(",\n")
+
+	if snapshot.Files == nil {
+		rw.raw(inner + `"files": null` + "\n" + indent + "}")
+		return
+	}
+	if len(snapshot.Files) == 0 {
+		rw.raw(inner + `"files": {}` + "\n" + indent + "}")
+		return
+	}
+
+	paths := make([]string, 0, len(snapshot.Files))
+	for path := range snapshot.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rw.raw(inner + `"files": {`)
+	for i, path := range paths {
+		if i > 0 {
+			rw.raw(",")
+		}
+		rw.raw("\n")
+		rw.field(inner+"  ", path, snapshot.Files[path])
+	}
+	rw.raw("\n" + inner + "}\n" + indent + "}")
+}
+
+// writeReportJSON streams report to w as indented JSON. The output is the
+// same as json.MarshalIndent(report, "", "  ") but each file entry is
+// encoded separately, so memory use does not grow with the workspace size.
+func writeReportJSON(w io.Writer, report WorkspaceReport) error {
+	rw := &reportWriter{w: bufio.NewWriter(w)}
+
+	rw.raw("{\n")
+	rw.snapshot("  ", "before", report.Before)
+	rw.raw(",\n")
+	rw.snapshot("  ", "after", report.After)
+	rw.raw(",\n")
+	rw.field("  ", "added", report.Added)
+	rw.raw(",\n")
+	rw.field("  ", "removed", report.Removed)
+	rw.raw(",\n")
+	rw.field("  ", "modified", report.Modified)
+	rw.raw(",\n")
+	if len(report.Touched) > 0 {
+		rw.field("  ", "touched", report.Touched)
+		rw.raw(",\n")
+	}
+	rw.field("  ", "summary", report.Summary)
+	rw.raw("\n}")
+
+	if rw.err != nil {
+		return rw.err
+	}
+	return rw.w.Flush()
+}
+
+// configFlags holds command-line settings that take precedence over the
+// config file; empty strings leave the file's values alone
+type configFlags struct {
+	server    string
+	model     string
+	workspace string
+}
+
+// apply overrides the config with any flags that were given. A
+// comma-separated server list replaces both ollama_server and
+// ollama_servers.
+func (f configFlags) apply(config *Config) {
+	if f.server != "" {
+		servers := strings.Split(f.server, ",")
+		config.OllamaServer = servers[0]
+		config.OllamaServers = nil
+		if len(servers) > 1 {
+			config.OllamaServers = servers
+		}
+	}
+	if f.model != "" {
+		config.ModelName = f.model
+	}
+	if f.workspace != "" {
+		config.WorkspaceDir = f.workspace
+	}
+}
+
 func main() {
-	engine, err := NewEngine()
+	configPath := flag.String("config", "config.json", "configuration file")
+	var overrides configFlags
+	flag.StringVar(&overrides.server, "server", "", "Ollama server address, or a comma-separated failover list (overrides the config file)")
+	flag.StringVar(&overrides.model, "model", "", "model name (overrides the config file)")
+	flag.StringVar(&overrides.workspace, "workspace", "", "workspace directory (overrides the config file)")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to create engine: %v", err)
+		log.Fatalf("Failed to create engine: failed to load config: %v", err)
+	}
+	overrides.apply(config)
+
+	var logFile *rotatingFile
+	if config.LogFile != "" {
+		logFile, err = openRotatingFile(config.LogFile, config.LogMaxBytes, config.LogBackups)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	}
+
+	// log.Fatal would exit without closing the log file, so the failure is
+	// logged and the file closed before exiting
+	err = run(config)
+	if err != nil {
+		log.Print(err)
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// run creates the engine for config and runs it
+func run(config *Config) error {
+	engine, err := NewEngine(config)
+	if err != nil {
+		return fmt.Errorf("Failed to create engine: %v", err)
 	}
 
 	if err := engine.Run(); err != nil {
-		log.Fatalf("Engine failed: %v", err)
+		return fmt.Errorf("Engine failed: %v", err)
 	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionUsesInjectedGenerator(t *testing.T) {
+	program := goProgram("")
+	generator := &fakeGenerator{responses: []string{program}}
+	e := newIteratingEngine(t, generator, 3)
+
+	if err := e.startDevelopmentSession(); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 1 {
+		t.Fatalf("%d generations, want 1", len(generator.prompts))
+	}
+	if !strings.HasPrefix(generator.prompts[0], e.systemPrompt()) {
+		t.Errorf("prompt does not start with the system prompt:\n%s", generator.prompts[0])
+	}
+	if !strings.Contains(e.output.(*bytes.Buffer).String(), "package main") {
+		t.Errorf("response not printed to the console")
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(program, strings.TrimSpace(string(data))) {
+		t.Errorf("main.go = %q, want the code block from the response", data)
+	}
+	if _, err := os.Stat(filepath.Join(e.config.WorkspaceDir, "tool")); err != nil {
+		t.Errorf("artifact not built: %v", err)
+	}
+}
+
+func TestSessionAnalyzesExistingArtifact(t *testing.T) {
+	generator := &fakeGenerator{responses: []string{"Looks fine."}}
+	e := newIteratingEngine(t, generator, 3)
+	if err := os.WriteFile(filepath.Join(e.config.WorkspaceDir, "tool"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.startDevelopmentSession(); err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.prompts) != 1 {
+		t.Fatalf("%d generations, want just the analysis", len(generator.prompts))
+	}
+	if got := e.output.(*bytes.Buffer).String(); got != "Looks fine.\n" {
+		t.Errorf("console = %q, want the analysis", got)
+	}
+}
+
+// fakeModelManager is a server with the given models, recording the models
+// it is asked to pull. versionErr, if set, is returned by Version.
+type fakeModelManager struct {
+	models     []string
+	versionErr error
+	pulled     []string
+}
+
+func (m *fakeModelManager) Version() (string, error) {
+	return "0.0.0-test", m.versionErr
+}
+
+func (m *fakeModelManager) ListModels() ([]string, error) {
+	return m.models, nil
+}
+
+func (m *fakeModelManager) PullModel(model string, progress func(status string, completed, total int64)) error {
+	m.pulled = append(m.pulled, model)
+	progress("downloading", 50, 100)
+	progress("success", 0, 0)
+	m.models = append(m.models, model+":latest")
+	return nil
+}
+
+func TestRunWithFakeServer(t *testing.T) {
+	generator := &fakeGenerator{responses: []string{goProgram("")}}
+	e := newIteratingEngine(t, generator, 3)
+	e.config.ModelName = "coder"
+	models := &fakeModelManager{models: []string{"other:latest"}}
+	e.models = models
+
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(models.pulled) != 1 || models.pulled[0] != "coder" {
+		t.Errorf("pulled %q, want the missing model", models.pulled)
+	}
+	if len(generator.prompts) != 1 {
+		t.Errorf("%d generations, want 1", len(generator.prompts))
+	}
+	data, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, "workspace-report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report WorkspaceReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(report.Added, " "), "main.go") {
+		t.Errorf("report added %q, want main.go among them", report.Added)
+	}
+
+	// A model the server already has is not pulled again
+	generator = &fakeGenerator{responses: []string{"Looks fine."}}
+	e.generator = generator
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(models.pulled) != 1 {
+		t.Errorf("pulled %q, want no second pull", models.pulled)
+	}
+}
+
+func TestRunReportsUnreachableServer(t *testing.T) {
+	generator := &fakeGenerator{}
+	e := newIteratingEngine(t, generator, 3)
+	e.models = &fakeModelManager{versionErr: fmt.Errorf("dial failed: %w", ErrConnection)}
+
+	err := e.Run()
+	if err == nil || !strings.Contains(err.Error(), "cannot reach Ollama") {
+		t.Errorf("got %v, want a connection error", err)
+	}
+	if len(generator.prompts) != 0 {
+		t.Errorf("%d generations against an unreachable server", len(generator.prompts))
+	}
+}
+
+// syntheticSnapshot returns a snapshot of n files, with names and contents
+// that need escaping in JSON
+func syntheticSnapshot(n int, when time.Time) WorkspaceSnapshot {
+	snapshot := WorkspaceSnapshot{Timestamp: when, HashAlgorithm: "sha256", Files: make(map[string]FileInfo)}
+	for i := 0; i < n; i++ {
+		path := fmt.Sprintf("dir%d/file \"%d\" <&>.go", i%10, i)
+		snapshot.Files[path] = FileInfo{Path: path, Size: int64(i), ModTime: when.Add(time.Duration(i) * time.Second), Hash: fmt.Sprintf("%064x", i), IsDir: i%100 == 0}
+	}
+	return snapshot
+}
+
+func TestWriteReportJSONMatchesMarshalIndent(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, report := range []WorkspaceReport{
+		{
+			Before:   syntheticSnapshot(5000, start),
+			After:    syntheticSnapshot(5001, start.Add(time.Hour)),
+			Added:    []string{"dir0/file \"5000\" <&>.go"},
+			Removed:  []string{},
+			Modified: []string{"a.go", "b.go"},
+			Touched:  []string{"c.go"},
+			Summary:  "Workspace changes:\n- Files added: 1\n",
+		},
+		{},
+	} {
+		var streamed bytes.Buffer
+		if err := writeReportJSON(&streamed, report); err != nil {
+			t.Fatal(err)
+		}
+		want, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(streamed.Bytes(), want) {
+			t.Errorf("streamed report with %d files differs from json.MarshalIndent", len(report.After.Files))
+		}
+		if !json.Valid(streamed.Bytes()) {
+			t.Errorf("streamed report with %d files is not valid JSON", len(report.After.Files))
+		}
+	}
+}
+
+// writeTree fills dir with n small files spread over a few directories,
+// returning their relative paths
+func writeTree(tb testing.TB, dir string, n int) []string {
+	var paths []string
+	for i := 0; i < n; i++ {
+		path := filepath.Join(fmt.Sprintf("pkg%d", i%8), fmt.Sprintf("file%d.go", i))
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		content := strings.Repeat(fmt.Sprintf("line %d\n", i), i%50+1)
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestParallelHashesMatchSequential(t *testing.T) {
+	logged := captureLog(t)
+	e := newTestEngine(t)
+	paths := writeTree(t, e.config.WorkspaceDir, 300)
+
+	want := make(map[string]string)
+	for _, path := range paths {
+		hash, err := e.calculateFileHash(filepath.Join(e.config.WorkspaceDir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[path] = hash
+	}
+	want["missing.go"] = ""
+
+	if got := e.hashFiles(append(paths, "missing.go")); !reflect.DeepEqual(got, want) {
+		t.Errorf("parallel hashes differ from sequential ones")
+	}
+	if !strings.Contains(logged.String(), "Warning: failed to hash file missing.go") {
+		t.Errorf("no warning for the unreadable file:\n%s", logged)
+	}
+
+	snapshot, err := e.takeWorkspaceSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if snapshot.Files[path].Hash != want[path] {
+			t.Errorf("snapshot hash of %s is %q, want %q", path, snapshot.Files[path].Hash, want[path])
+		}
+	}
+}
+
+func BenchmarkTakeWorkspaceSnapshot(b *testing.B) {
+	e := &Engine{config: &Config{WorkspaceDir: b.TempDir()}}
+	writeTree(b, e.config.WorkspaceDir, 2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.takeWorkspaceSnapshot(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReportTouchedFiles(t *testing.T) {
+	e := newTestEngine(t)
+	dir := e.config.WorkspaceDir
+	writeFile(t, dir, "same.go", "package main\n")
+	writeFile(t, dir, "changed.go", "package main\n")
+	before, err := e.takeWorkspaceSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, dir, "same.go", "package main\n")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "same.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "changed.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, dir, "added.go", "package main\n")
+	after, err := e.takeWorkspaceSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := e.generateWorkspaceReport(before, after)
+	if !reflect.DeepEqual(report.Added, []string{"added.go"}) || !reflect.DeepEqual(report.Modified, []string{"changed.go"}) {
+		t.Errorf("added %q and modified %q, want added.go and changed.go", report.Added, report.Modified)
+	}
+	if report.Touched != nil {
+		t.Errorf("touched %q without report_touched", report.Touched)
+	}
+
+	e.config.ReportTouched = true
+	report = e.generateWorkspaceReport(before, after)
+	if !reflect.DeepEqual(report.Touched, []string{"same.go"}) || !reflect.DeepEqual(report.Modified, []string{"changed.go"}) {
+		t.Errorf("touched %q and modified %q, want same.go only touched", report.Touched, report.Modified)
+	}
+}
+
+func TestConfigFlagsTakePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "config.json", `{
+		"ollama_server": "file-server:11434",
+		"ollama_servers": ["file-a:11434", "file-b:11434"],
+		"model_name": "file-model",
+		"workspace_dir": "/file/workspace"
+	}`)
+
+	for _, test := range []struct {
+		name      string
+		flags     configFlags
+		servers   []string
+		model     string
+		workspace string
+	}{
+		{"no flags", configFlags{}, []string{"file-a:11434", "file-b:11434"}, "file-model", "/file/workspace"},
+		{"one server", configFlags{server: "flag:11434"}, []string{"flag:11434"}, "file-model", "/file/workspace"},
+		{"server list", configFlags{server: "x:1,y:2"}, []string{"x:1", "y:2"}, "file-model", "/file/workspace"},
+		{"model and workspace", configFlags{model: "flag-model", workspace: "/flag/workspace"}, []string{"file-a:11434", "file-b:11434"}, "flag-model", "/flag/workspace"},
+	} {
+		config, err := loadConfig(filepath.Join(dir, "config.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.flags.apply(config)
+		if !reflect.DeepEqual(config.servers(), test.servers) || config.ModelName != test.model || config.WorkspaceDir != test.workspace {
+			t.Errorf("%s: got servers %q, model %s, workspace %s; want %q, %s, %s", test.name,
+				config.servers(), config.ModelName, config.WorkspaceDir, test.servers, test.model, test.workspace)
+		}
+	}
+}
@@ -2,33 +2,194 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// OllamaClient handles communication with the Ollama API
+// Generator produces a completion for a prompt. OllamaClient satisfies it;
+// tests can substitute a fake to drive the engine without a live server.
+type Generator interface {
+	Generate(model, prompt string) (string, error)
+}
+
+// RequestGenerator is a Generator that takes a full GenerateRequest and
+// returns the full response. The engine uses it when available to send a
+// system prompt and to count tokens against its budget.
+type RequestGenerator interface {
+	Generator
+	Do(ctx context.Context, req GenerateRequest) (GenerateResponse, error)
+}
+
+// StreamingGenerator is a RequestGenerator that can also stream the
+// response text as it is generated, which the engine uses to show progress
+type StreamingGenerator interface {
+	RequestGenerator
+	DoStream(ctx context.Context, req GenerateRequest, onChunk func(string) error) (GenerateResponse, error)
+}
+
+// ModelManager checks that a server is up and has a model, pulling it if
+// not. The engine does this before a session.
+type ModelManager interface {
+	Version() (string, error)
+	ListModels() ([]string, error)
+	PullModel(model string, progress func(status string, completed, total int64)) error
+}
+
+// OllamaClient handles communication with the Ollama API. When several
+// servers are configured they are tried in order, failing over to the next
+// one when a server cannot be reached.
 type OllamaClient struct {
-	baseURL string
-	client  *http.Client
+	baseURLs  []string
+	client    *http.Client
+	dumpMu    sync.Mutex
+	dumpDir   string        // set by DumpNextRequest, cleared once used; guarded by dumpMu
+	slots     chan struct{} // limits concurrent generations when not nil
+	keepAlive interface{}   // sent as keep_alive on generate and chat requests when set
 }
 
 // GenerateRequest represents a request to the Ollama generate API
 type GenerateRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
+	Model     string      `json:"model"`
+	Prompt    string      `json:"prompt"`
+	System    string      `json:"system,omitempty"`
+	Context   []int       `json:"context,omitempty"` // from a previous response, to continue that conversation
+	Stream    bool        `json:"stream"`
+	Options   Options     `json:"options,omitempty"`
+	KeepAlive interface{} `json:"keep_alive,omitempty"`
 }
 
+// Options holds model parameters sent in a request's options field, such
+// as temperature, top_p, top_k, seed and num_predict. A fixed seed with
+// temperature 0 makes responses reproducible.
+type Options map[string]interface{}
+
 // GenerateResponse represents a response from the Ollama generate API
 type GenerateResponse struct {
 	Model     string    `json:"model"`
 	CreatedAt time.Time `json:"created_at"`
 	Response  string    `json:"response"`
 	Done      bool      `json:"done"`
+
+	// Context encodes the conversation so far, only present on the final
+	// response. Passing it in the next request continues the conversation
+	// without resending the history.
+	Context []int `json:"context"`
+
+	// Metrics, only present on the final response. Durations are in
+	// nanoseconds.
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalCount    int   `json:"prompt_eval_count"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalCount          int   `json:"eval_count"`
+	EvalDuration       int64 `json:"eval_duration"`
+}
+
+// GenerateStats summarizes the timing and token counts of a generation
+type GenerateStats struct {
+	TotalDuration      time.Duration
+	LoadDuration       time.Duration
+	PromptTokens       int
+	PromptEvalDuration time.Duration
+	ResponseTokens     int
+	EvalDuration       time.Duration
+}
+
+// Stats extracts the metrics from a final generate response
+func (r GenerateResponse) Stats() GenerateStats {
+	return GenerateStats{
+		TotalDuration:      time.Duration(r.TotalDuration),
+		LoadDuration:       time.Duration(r.LoadDuration),
+		PromptTokens:       r.PromptEvalCount,
+		PromptEvalDuration: time.Duration(r.PromptEvalDuration),
+		ResponseTokens:     r.EvalCount,
+		EvalDuration:       time.Duration(r.EvalDuration),
+	}
+}
+
+// TokensPerSecond returns the response generation rate, or 0 if unknown
+func (s GenerateStats) TokensPerSecond() float64 {
+	if s.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(s.ResponseTokens) / s.EvalDuration.Seconds()
+}
+
+// ChatMessage is one message in a chat conversation. Role is "system",
+// "user" or "assistant".
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest represents a request to the Ollama chat API
+type ChatRequest struct {
+	Model     string        `json:"model"`
+	Messages  []ChatMessage `json:"messages"`
+	Stream    bool          `json:"stream"`
+	Options   Options       `json:"options,omitempty"`
+	KeepAlive interface{}   `json:"keep_alive,omitempty"`
+}
+
+// ChatResponse represents a response from the Ollama chat API
+type ChatResponse struct {
+	Model     string      `json:"model"`
+	CreatedAt time.Time   `json:"created_at"`
+	Message   ChatMessage `json:"message"`
+	Done      bool        `json:"done"`
+}
+
+// EmbeddingsRequest represents a request to the Ollama embeddings API
+type EmbeddingsRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// EmbeddingsResponse represents a response from the Ollama embeddings API
+type EmbeddingsResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// PullRequest represents a request to the Ollama pull API
+type PullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+// PullProgress is one line of the streamed pull API response
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// ErrorResponse is the body Ollama returns with a failing status
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ModelInfo describes a model available on the server
+type ModelInfo struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	ModifiedAt time.Time `json:"modified_at"`
 }
 
 // HealthResponse represents a response from the Ollama health check
@@ -38,76 +199,455 @@ type HealthResponse struct {
 
 // NewOllamaClient creates a new Ollama API client
 func NewOllamaClient(serverAddr string) *OllamaClient {
+	return NewOllamaClientWithServers([]string{serverAddr})
+}
+
+// NewOllamaClientWithServers creates a client that fails over across the
+// given servers in order
+func NewOllamaClientWithServers(serverAddrs []string) *OllamaClient {
+	baseURLs := make([]string, len(serverAddrs))
+	for i, addr := range serverAddrs {
+		baseURLs[i] = fmt.Sprintf("http://%s", addr)
+	}
+
 	return &OllamaClient{
-		baseURL: fmt.Sprintf("http://%s", serverAddr),
+		baseURLs: baseURLs,
 		client: &http.Client{
-			Timeout: 3 * 60 * 60 * time.Second, // 3 hour timeout for LLM responses
+			Timeout: defaultTimeout,
 		},
 	}
 }
 
-// HealthCheck verifies the Ollama server is accessible
+// defaultTimeout is long because large models can take hours on big prompts
+const defaultTimeout = 3 * 60 * 60 * time.Second
+
+// clientSettings collects the values set by ClientOptions
+type clientSettings struct {
+	scheme        string
+	httpClient    *http.Client
+	timeout       time.Duration
+	timeoutSet    bool // WithTimeout was given
+	maxConcurrent int
+	keepAlive     interface{}
+}
+
+// ClientOption configures a client created by NewOllamaClientWithOptions
+type ClientOption func(*clientSettings)
+
+// WithScheme sets the URL scheme, "http" (the default) or "https"
+func WithScheme(scheme string) ClientOption {
+	return func(s *clientSettings) { s.scheme = scheme }
+}
+
+// WithHTTPClient sets the HTTP client used for requests, for example one
+// with a proxy or custom TLS configuration. The client is copied, not
+// modified.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(s *clientSettings) { s.httpClient = client }
+}
+
+// WithTimeout sets the overall timeout for each request. Without it, a
+// client given by WithHTTPClient keeps its own timeout and an internally
+// created one gets the default.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(s *clientSettings) {
+		s.timeout = timeout
+		s.timeoutSet = true
+	}
+}
+
+// WithMaxConcurrent limits the number of generate and chat requests in
+// flight at once; further calls block until a slot frees. Zero means no
+// limit.
+func WithMaxConcurrent(n int) ClientOption {
+	return func(s *clientSettings) { s.maxConcurrent = n }
+}
+
+// WithKeepAlive sets how long the server keeps the model loaded after each
+// generate or chat request, as a duration such as "10m" or a number of
+// seconds; a negative value keeps it loaded indefinitely. Keeping the model
+// loaded between engine iterations avoids reloading it every time.
+func WithKeepAlive(keepAlive string) ClientOption {
+	return func(s *clientSettings) {
+		if seconds, err := strconv.Atoi(keepAlive); err == nil {
+			s.keepAlive = seconds
+		} else {
+			s.keepAlive = keepAlive
+		}
+	}
+}
+
+// NewOllamaClientWithOptions creates a client for the given servers,
+// failing over in order, and validates each "host:port" address
+func NewOllamaClientWithOptions(serverAddrs []string, opts ...ClientOption) (*OllamaClient, error) {
+	settings := clientSettings{scheme: "http", timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	if settings.scheme != "http" && settings.scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q, want http or https", settings.scheme)
+	}
+	if settings.timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout %v", settings.timeout)
+	}
+	if settings.maxConcurrent < 0 {
+		return nil, fmt.Errorf("invalid concurrency limit %d", settings.maxConcurrent)
+	}
+	if keepAlive, ok := settings.keepAlive.(string); ok {
+		if _, err := time.ParseDuration(keepAlive); err != nil {
+			return nil, fmt.Errorf("invalid keep-alive %q: %v", keepAlive, err)
+		}
+	}
+	if len(serverAddrs) == 0 {
+		return nil, fmt.Errorf("no Ollama servers configured")
+	}
+
+	baseURLs := make([]string, len(serverAddrs))
+	for i, addr := range serverAddrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server address %q: %v", addr, err)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("invalid server address %q: missing host", addr)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid server address %q: bad port", addr)
+		}
+		baseURLs[i] = fmt.Sprintf("%s://%s", settings.scheme, addr)
+	}
+
+	client := &http.Client{Timeout: settings.timeout}
+	if settings.httpClient != nil {
+		copied := *settings.httpClient
+		client = &copied
+		if settings.timeoutSet {
+			client.Timeout = settings.timeout
+		}
+	}
+
+	c := &OllamaClient{
+		baseURLs:  baseURLs,
+		client:    client,
+		keepAlive: settings.keepAlive,
+	}
+	if settings.maxConcurrent > 0 {
+		c.slots = make(chan struct{}, settings.maxConcurrent)
+	}
+	return c, nil
+}
+
+// Errors returned by HealthCheck and Version, distinguishing a server that
+// cannot be reached from one that responds but is unhealthy
+var (
+	ErrConnection = errors.New("cannot connect to Ollama server")
+	ErrServer     = errors.New("Ollama server error")
+)
+
+// HealthCheck verifies at least one Ollama server is accessible and
+// healthy. The error wraps ErrConnection or ErrServer.
 func (c *OllamaClient) HealthCheck() error {
-	resp, err := c.client.Get(c.baseURL + "/api/tags")
+	_, err := c.Version()
+	return err
+}
+
+// Version returns the version reported by the first healthy server. The
+// error wraps ErrConnection or ErrServer, from the last server tried.
+func (c *OllamaClient) Version() (string, error) {
+	var lastErr error
+	for _, baseURL := range c.baseURLs {
+		version, err := c.serverVersion(baseURL)
+		if err != nil {
+			lastErr = err
+			log.Printf("Warning: %v", lastErr)
+			continue
+		}
+		return version, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%w: no Ollama servers configured", ErrConnection)
+	}
+	return "", lastErr
+}
+
+// serverVersion queries /api/version on one server
+func (c *OllamaClient) serverVersion(baseURL string) (string, error) {
+	resp, err := c.client.Get(baseURL + "/api/version")
 	if err != nil {
-		return fmt.Errorf("failed to connect to Ollama server at %s: %v", c.baseURL, err)
+		return "", fmt.Errorf("%w at %s: %v", ErrConnection, baseURL, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Ollama server returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("%w: %s returned status %d", ErrServer, baseURL, resp.StatusCode)
+	}
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("%w: %s returned an invalid version response: %v", ErrServer, baseURL, err)
+	}
+	return result.Version, nil
+}
+
+// get issues a GET request against the first reachable server. Failover
+// stops as soon as ctx is done.
+func (c *OllamaClient) get(ctx context.Context, path string) (*http.Response, error) {
+	var lastErr error
+	for _, baseURL := range c.baseURLs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		resp, err := c.client.Do(req)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("request to %s cancelled: %w", baseURL+path, ctx.Err())
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("failed to send request to %s: %v", baseURL+path, err)
+			log.Printf("Warning: %v, trying next server", lastErr)
+			continue
+		}
+		return resp, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no Ollama servers configured")
+	}
+	return nil, lastErr
+}
+
+// post sends a JSON body to the first reachable server. Failover stops as
+// soon as ctx is done.
+func (c *OllamaClient) post(ctx context.Context, reqID, path string, jsonData []byte) (*http.Response, error) {
+	var lastErr error
+	for _, baseURL := range c.baseURLs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+path, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.client.Do(req)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("request to %s cancelled: %w", baseURL+path, ctx.Err())
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("failed to send request to %s: %v", baseURL+path, err)
+			log.Printf("[req %s] Warning: %v, trying next server", reqID, lastErr)
+			continue
+		}
+		return resp, nil
 	}
 
-	return nil
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no Ollama servers configured")
+	}
+	return nil, lastErr
+}
+
+// DumpNextRequest makes the next generate call write its JSON request body
+// and raw response body, pretty-printed, to <id>-request.json and
+// <id>-response.json in dir. A streamed response is written as received,
+// one JSON object per line.
+func (c *OllamaClient) DumpNextRequest(dir string) {
+	c.dumpMu.Lock()
+	defer c.dumpMu.Unlock()
+	c.dumpDir = dir
+}
+
+// takeDumpDir returns the directory set by DumpNextRequest, if any, and
+// clears it, so only one of several concurrent calls dumps
+func (c *OllamaClient) takeDumpDir() string {
+	c.dumpMu.Lock()
+	defer c.dumpMu.Unlock()
+	dir := c.dumpDir
+	c.dumpDir = ""
+	return dir
+}
+
+// dump writes one side of a dumped call, indenting it if it is valid JSON
+func dump(dir, reqID, kind string, data []byte) {
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, data, "", "  "); err != nil {
+		pretty.Reset()
+		pretty.Write(data)
+	}
+	pretty.WriteByte('\n')
+
+	path := filepath.Join(dir, reqID+"-"+kind+".json")
+	if err := os.WriteFile(path, pretty.Bytes(), 0644); err != nil {
+		log.Printf("[req %s] Warning: failed to dump %s: %v", reqID, kind, err)
+		return
+	}
+	log.Printf("[req %s] Dumped %s to %s", reqID, kind, path)
+}
+
+// acquire waits for a free request slot, if the client limits concurrency
+func (c *OllamaClient) acquire(ctx context.Context, reqID string) error {
+	if c.slots == nil {
+		return nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	log.Printf("[req %s] All %d request slots busy, waiting", reqID, cap(c.slots))
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("cancelled while waiting for a request slot: %w", ctx.Err())
+	}
+}
+
+// release frees a slot taken by acquire
+func (c *OllamaClient) release() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+// newRequestID returns a short random ID used to correlate the log lines
+// belonging to one API call
+func newRequestID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
 }
 
 // Generate sends a prompt to the specified model and returns the response
 func (c *OllamaClient) Generate(model, prompt string) (string, error) {
-	log.Printf("Sending request to model %s (prompt length: %d chars)", model, len(prompt))
-	
-	req := GenerateRequest{
-		Model:  model,
-		Prompt: prompt,
-		Stream: false, // Use non-streaming for simplicity
+	return c.GenerateContext(context.Background(), model, prompt)
+}
+
+// GenerateContext is Generate with a context; cancelling ctx aborts the
+// request and the returned error wraps ctx.Err()
+func (c *OllamaClient) GenerateContext(ctx context.Context, model, prompt string) (string, error) {
+	response, err := c.generate(ctx, GenerateRequest{Model: model, Prompt: prompt})
+	return response.Response, err
+}
+
+// GenerateWithOptions is Generate with model parameters such as
+// temperature and seed
+func (c *OllamaClient) GenerateWithOptions(model, prompt string, options Options) (string, error) {
+	response, err := c.generate(context.Background(), GenerateRequest{Model: model, Prompt: prompt, Options: options})
+	return response.Response, err
+}
+
+// GenerateWithSystem is Generate with a system prompt, which steers the
+// model's behavior separately from the task in prompt
+func (c *OllamaClient) GenerateWithSystem(model, system, prompt string) (string, error) {
+	response, err := c.generate(context.Background(), GenerateRequest{Model: model, Prompt: prompt, System: system})
+	return response.Response, err
+}
+
+// GenerateContinue is Generate that continues the conversation encoded by
+// history, as returned by a previous call (nil starts a new one), and
+// returns the updated history alongside the text
+func (c *OllamaClient) GenerateContinue(model, prompt string, history []int) (string, []int, error) {
+	response, err := c.generate(context.Background(), GenerateRequest{Model: model, Prompt: prompt, Context: history})
+	if err != nil {
+		return "", history, err
 	}
+	return response.Response, response.Context, nil
+}
 
-	jsonData, err := json.Marshal(req)
+// Do sends a non-streaming generate request built by the caller and
+// returns the full response, including metrics. Stream is ignored.
+func (c *OllamaClient) Do(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	return c.generate(ctx, req)
+}
+
+// GenerateWithStats is Generate that also returns the server's timing and
+// token counts for the request
+func (c *OllamaClient) GenerateWithStats(model, prompt string) (string, GenerateStats, error) {
+	response, err := c.generate(context.Background(), GenerateRequest{Model: model, Prompt: prompt})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return "", GenerateStats{}, err
 	}
+	return response.Response, response.Stats(), nil
+}
 
-	log.Println("Waiting for LLM response... (this may take several minutes for complex requests)")
-	resp, err := c.client.Post(
-		c.baseURL+"/api/generate",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+// generate sends a non-streaming generate request
+func (c *OllamaClient) generate(ctx context.Context, req GenerateRequest) (response GenerateResponse, err error) {
+	reqID := newRequestID()
+	defer func() {
+		if err != nil {
+			log.Printf("[req %s] Request failed: %v", reqID, err)
+		}
+	}()
+
+	if err := c.acquire(ctx, reqID); err != nil {
+		return GenerateResponse{}, err
+	}
+	defer c.release()
+
+	log.Printf("[req %s] Sending request to model %s (prompt length: %d chars)", reqID, req.Model, len(req.Prompt))
+
+	req.Stream = false // Use non-streaming for simplicity
+	if req.KeepAlive == nil {
+		req.KeepAlive = c.keepAlive
+	}
+
+	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request to %s: %v", c.baseURL+"/api/generate", err)
+		return GenerateResponse{}, fmt.Errorf("failed to marshal request: %v", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	dumpDir := c.takeDumpDir()
+	if dumpDir != "" {
+		dump(dumpDir, reqID, "request", jsonData)
+	}
+
+	log.Printf("[req %s] Waiting for LLM response... (this may take several minutes for complex requests)", reqID)
+	resp, err := c.post(ctx, reqID, "/api/generate", jsonData)
+	if err != nil {
+		return GenerateResponse{}, err
 	}
+	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	if ctx.Err() != nil {
+		return GenerateResponse{}, fmt.Errorf("request cancelled: %w", ctx.Err())
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
+		return GenerateResponse{}, fmt.Errorf("failed to read response: %v", err)
+	}
+	if dumpDir != "" {
+		dump(dumpDir, reqID, "response", body)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return GenerateResponse{}, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var response GenerateResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
+		return GenerateResponse{}, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	log.Printf("Received LLM response (length: %d chars)", len(response.Response))
-	return response.Response, nil
+	log.Printf("[req %s] Received LLM response (length: %d chars)", reqID, len(response.Response))
+	if stats := response.Stats(); stats.ResponseTokens > 0 {
+		log.Printf("[req %s] %d prompt tokens, %d response tokens at %.1f tokens/sec", reqID, stats.PromptTokens, stats.ResponseTokens, stats.TokensPerSecond())
+	}
+	return response, nil
 }
 
 // GenerateStream sends a prompt and returns a channel for streaming responses
 func (c *OllamaClient) GenerateStream(model, prompt string) (<-chan string, <-chan error) {
+	return c.GenerateStreamContext(context.Background(), model, prompt)
+}
+
+// GenerateStreamContext is GenerateStream with a context. Cancelling ctx
+// stops the stream, and the error channel then reports an error wrapping
+// ctx.Err().
+func (c *OllamaClient) GenerateStreamContext(ctx context.Context, model, prompt string) (<-chan string, <-chan error) {
 	responses := make(chan string)
 	errors := make(chan error, 1)
 
@@ -115,62 +655,309 @@ func (c *OllamaClient) GenerateStream(model, prompt string) (<-chan string, <-ch
 		defer close(responses)
 		defer close(errors)
 
-		req := GenerateRequest{
-			Model:  model,
-			Prompt: prompt,
-			Stream: true,
+		_, err := c.stream(ctx, GenerateRequest{Model: model, Prompt: prompt}, func(chunk string) error {
+			select {
+			case responses <- chunk:
+				return nil
+			case <-ctx.Done():
+				return fmt.Errorf("stream cancelled: %w", ctx.Err())
+			}
+		})
+		if err != nil {
+			errors <- err
 		}
+	}()
+
+	return responses, errors
+}
+
+// DoStream is Do with streaming: onChunk is called with each piece of text
+// as it arrives, and the final response, with Response holding the whole
+// text, is returned once the stream ends. If onChunk returns an error the
+// request is abandoned and that error is returned.
+func (c *OllamaClient) DoStream(ctx context.Context, req GenerateRequest, onChunk func(string) error) (GenerateResponse, error) {
+	return c.stream(ctx, req, onChunk)
+}
 
-		jsonData, err := json.Marshal(req)
+// stream sends a streaming generate request, passing each piece of text to
+// onChunk, and returns the final response with the accumulated text
+func (c *OllamaClient) stream(ctx context.Context, req GenerateRequest, onChunk func(string) error) (final GenerateResponse, err error) {
+	reqID := newRequestID()
+	var text strings.Builder
+	defer func() {
 		if err != nil {
-			errors <- fmt.Errorf("failed to marshal request: %v", err)
+			log.Printf("[req %s] Streaming request failed: %v", reqID, err)
 			return
 		}
+		log.Printf("[req %s] Streaming response complete (length: %d chars)", reqID, text.Len())
+	}()
+
+	if err := c.acquire(ctx, reqID); err != nil {
+		return GenerateResponse{}, err
+	}
+	defer c.release()
+
+	log.Printf("[req %s] Sending streaming request to model %s (prompt length: %d chars)", reqID, req.Model, len(req.Prompt))
+
+	req.Stream = true
+	if req.KeepAlive == nil {
+		req.KeepAlive = c.keepAlive
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return GenerateResponse{}, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	dumpDir := c.takeDumpDir()
+	if dumpDir != "" {
+		dump(dumpDir, reqID, "request", jsonData)
+	}
 
-		resp, err := c.client.Post(
-			c.baseURL+"/api/generate",
-			"application/json",
-			bytes.NewBuffer(jsonData),
-		)
+	resp, err := c.post(ctx, reqID, "/api/generate", jsonData)
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	// A dumped stream holds every line received, one JSON object per line
+	var body io.Reader = resp.Body
+	if dumpDir != "" {
+		var raw bytes.Buffer
+		body = io.TeeReader(resp.Body, &raw)
+		defer func() { dump(dumpDir, reqID, "response", raw.Bytes()) }()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(body)
+		return GenerateResponse{}, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(data))
+	}
+
+	decoder := json.NewDecoder(body)
+	for {
+		var response GenerateResponse
+		if err := decoder.Decode(&response); err != nil {
+			if ctx.Err() != nil {
+				return GenerateResponse{}, fmt.Errorf("stream cancelled: %w", ctx.Err())
+			}
+			if err == io.EOF {
+				break
+			}
+			return GenerateResponse{}, fmt.Errorf("failed to decode response: %v", err)
+		}
+
+		text.WriteString(response.Response)
+		if err := onChunk(response.Response); err != nil {
+			return GenerateResponse{}, err
+		}
+
+		final = response
+		if response.Done {
+			break
+		}
+	}
+
+	final.Response = text.String()
+	return final, nil
+}
+
+// GenerateStreamFunc streams a generation, calling onChunk with each piece
+// of text as it arrives. If onChunk returns an error the request is
+// cancelled and that error is returned.
+func (c *OllamaClient) GenerateStreamFunc(model, prompt string, onChunk func(string) error) error {
+	_, err := c.stream(context.Background(), GenerateRequest{Model: model, Prompt: prompt}, onChunk)
+	return err
+}
+
+// Chat sends a conversation to the specified model and returns the
+// assistant's reply. Appending the reply and the next user message to
+// messages continues the conversation.
+func (c *OllamaClient) Chat(model string, messages []ChatMessage) (ChatMessage, error) {
+	return c.ChatContext(context.Background(), model, messages)
+}
+
+// ChatContext is Chat with a context for cancellation
+func (c *OllamaClient) ChatContext(ctx context.Context, model string, messages []ChatMessage) (reply ChatMessage, err error) {
+	reqID := newRequestID()
+	defer func() {
 		if err != nil {
-			errors <- fmt.Errorf("failed to send request: %v", err)
-			return
+			log.Printf("[req %s] Chat request failed: %v", reqID, err)
 		}
-		defer resp.Body.Close()
+	}()
 
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			errors <- fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-			return
+	if err := c.acquire(ctx, reqID); err != nil {
+		return ChatMessage{}, err
+	}
+	defer c.release()
+
+	log.Printf("[req %s] Sending chat request to model %s (%d messages)", reqID, model, len(messages))
+
+	req := ChatRequest{
+		Model:     model,
+		Messages:  messages,
+		Stream:    false,
+		KeepAlive: c.keepAlive,
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return ChatMessage{}, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := c.post(ctx, reqID, "/api/chat", jsonData)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return ChatMessage{}, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if ctx.Err() != nil {
+		return ChatMessage{}, fmt.Errorf("request cancelled: %w", ctx.Err())
+	}
+	if err != nil {
+		return ChatMessage{}, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var response ChatResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ChatMessage{}, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	log.Printf("[req %s] Received chat response (length: %d chars)", reqID, len(response.Message.Content))
+	return response.Message, nil
+}
+
+// Embeddings returns the embedding vector for prompt from the specified
+// model. An empty vector, which Ollama returns for models that do not
+// support embeddings, is reported as an error.
+func (c *OllamaClient) Embeddings(model, prompt string) ([]float64, error) {
+	reqID := newRequestID()
+
+	jsonData, err := json.Marshal(EmbeddingsRequest{Model: model, Prompt: prompt})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := c.post(context.Background(), reqID, "/api/embeddings", jsonData)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("embeddings request failed with status %d: %s", resp.StatusCode, errResp.Error)
 		}
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
 
-		decoder := json.NewDecoder(resp.Body)
-		for {
-			var response GenerateResponse
-			if err := decoder.Decode(&response); err != nil {
-				if err == io.EOF {
-					break
-				}
-				errors <- fmt.Errorf("failed to decode response: %v", err)
-				return
-			}
+	var response EmbeddingsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	if len(response.Embedding) == 0 {
+		return nil, fmt.Errorf("model %s returned an empty embedding", model)
+	}
 
-			responses <- response.Response
+	log.Printf("[req %s] Received embedding from model %s (%d dimensions)", reqID, model, len(response.Embedding))
+	return response.Embedding, nil
+}
 
-			if response.Done {
-				break
-			}
+// PullModel downloads a model to the server, calling progress (if not nil)
+// for each status line the server streams. It returns once the server
+// reports success, or with an error if the stream fails or ends early.
+func (c *OllamaClient) PullModel(model string, progress func(status string, completed, total int64)) (err error) {
+	reqID := newRequestID()
+	defer func() {
+		if err != nil {
+			log.Printf("[req %s] Pull of %s failed: %v", reqID, model, err)
 		}
 	}()
 
-	return responses, errors
+	log.Printf("[req %s] Pulling model %s", reqID, model)
+
+	jsonData, err := json.Marshal(PullRequest{Model: model, Stream: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := c.post(context.Background(), reqID, "/api/pull", jsonData)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line PullProgress
+		if err := decoder.Decode(&line); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("pull of %s ended without success", model)
+			}
+			return fmt.Errorf("failed to decode pull progress: %v", err)
+		}
+
+		if line.Error != "" {
+			return fmt.Errorf("pull of %s failed: %s", model, line.Error)
+		}
+		if progress != nil {
+			progress(line.Status, line.Completed, line.Total)
+		}
+		if line.Status == "success" {
+			log.Printf("[req %s] Pulled model %s", reqID, model)
+			return nil
+		}
+	}
 }
 
 // ListModels returns the list of available models
 func (c *OllamaClient) ListModels() ([]string, error) {
-	resp, err := c.client.Get(c.baseURL + "/api/tags")
+	return c.ListModelsContext(context.Background())
+}
+
+// ListModelsContext is ListModels with a context for cancellation
+func (c *OllamaClient) ListModelsContext(ctx context.Context) ([]string, error) {
+	details, err := c.ListModelsDetailedContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get models: %v", err)
+		return nil, err
+	}
+
+	var models []string
+	for _, model := range details {
+		models = append(models, model.Name)
+	}
+
+	return models, nil
+}
+
+// ListModelsDetailed returns the available models with their size, digest
+// and modification time
+func (c *OllamaClient) ListModelsDetailed() ([]ModelInfo, error) {
+	return c.ListModelsDetailedContext(context.Background())
+}
+
+// ListModelsDetailedContext is ListModelsDetailed with a context for
+// cancellation
+func (c *OllamaClient) ListModelsDetailedContext(ctx context.Context) ([]ModelInfo, error) {
+	resp, err := c.get(ctx, "/api/tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get models: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -184,19 +971,12 @@ func (c *OllamaClient) ListModels() ([]string, error) {
 	}
 
 	var result struct {
-		Models []struct {
-			Name string `json:"name"`
-		} `json:"models"`
+		Models []ModelInfo `json:"models"`
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	var models []string
-	for _, model := range result.Models {
-		models = append(models, model.Name)
-	}
-
-	return models, nil
+	return result.Models, nil
 }
\ No newline at end of file
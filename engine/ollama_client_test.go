@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serverAddr returns the host:port of a test server, as the client expects
+func serverAddr(server *httptest.Server) string {
+	return server.Listener.Addr().String()
+}
+
+// downAddr returns the address of a server that has been shut down
+func downAddr() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return serverAddr(server)
+}
+
+// generateHandler answers every generate request with response
+func generateHandler(response string) http.HandlerFunc {
+	return jsonHandler(`{"model":"m","response":"` + response + `","done":true}`)
+}
+
+// jsonHandler answers every request with the given JSON body
+func jsonHandler(response string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}
+}
+
+// captureLog collects the standard logger's output for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestGenerateFailsOver(t *testing.T) {
+	server := httptest.NewServer(generateHandler("from second"))
+	defer server.Close()
+
+	client := NewOllamaClientWithServers([]string{downAddr(), serverAddr(server)})
+	response, err := client.Generate("m", "p")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if response != "from second" {
+		t.Errorf("got %q, want the second server's response", response)
+	}
+}
+
+func TestGenerateAllServersDown(t *testing.T) {
+	client := NewOllamaClientWithServers([]string{downAddr(), downAddr()})
+	if _, err := client.Generate("m", "p"); err == nil {
+		t.Error("Generate succeeded with every server down")
+	}
+}
+
+func TestGenerateLogsOneRequestID(t *testing.T) {
+	server := httptest.NewServer(generateHandler("ok"))
+	defer server.Close()
+	logged := captureLog(t)
+
+	if _, err := NewOllamaClient(serverAddr(server)).Generate("m", "p"); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	sent := regexp.MustCompile(`\[req ([0-9a-f]{8})\] Sending request`).FindStringSubmatch(logged.String())
+	if sent == nil {
+		t.Fatalf("no request ID on the sending line:\n%s", logged)
+	}
+	if !strings.Contains(logged.String(), "[req "+sent[1]+"] Received LLM response") {
+		t.Errorf("request ID %s missing from the response line:\n%s", sent[1], logged)
+	}
+}
+
+// slowServer returns a server whose handler signals arrived and then
+// blocks until the test ends
+func slowServer(t *testing.T) (server *httptest.Server, arrived chan struct{}) {
+	arrived = make(chan struct{}, 1)
+	release := make(chan struct{})
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return server, arrived
+}
+
+func TestContextCancelsSlowRequest(t *testing.T) {
+	captureLog(t)
+	for _, test := range []struct {
+		name string
+		call func(ctx context.Context, client *OllamaClient) error
+	}{
+		{"GenerateContext", func(ctx context.Context, client *OllamaClient) error {
+			_, err := client.GenerateContext(ctx, "m", "p")
+			return err
+		}},
+		{"GenerateStreamContext", func(ctx context.Context, client *OllamaClient) error {
+			responses, errs := client.GenerateStreamContext(ctx, "m", "p")
+			for range responses {
+			}
+			return <-errs
+		}},
+		{"ListModelsContext", func(ctx context.Context, client *OllamaClient) error {
+			_, err := client.ListModelsContext(ctx)
+			return err
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, arrived := slowServer(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-arrived
+				cancel()
+			}()
+
+			err := test.call(ctx, NewOllamaClient(serverAddr(server)))
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want context.Canceled", err)
+			}
+		})
+	}
+}
+
+// recordingServer answers every request with response and records the
+// path and decoded JSON body of the latest request
+func recordingServer(t *testing.T, response string) (server *httptest.Server, last func() (path string, body map[string]interface{})) {
+	var mu sync.Mutex
+	var lastPath string
+	var lastBody map[string]interface{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("request body %q is not JSON: %v", data, err)
+		}
+		mu.Lock()
+		lastPath, lastBody = r.URL.Path, body
+		mu.Unlock()
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() (string, map[string]interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastPath, lastBody
+	}
+}
+
+func TestGenerateWithOptionsSendsOptions(t *testing.T) {
+	captureLog(t)
+	server, last := recordingServer(t, `{"model":"m","response":"ok","done":true}`)
+	client := NewOllamaClient(serverAddr(server))
+
+	options := Options{"temperature": 0, "seed": 42, "num_predict": 100}
+	if _, err := client.GenerateWithOptions("m", "p", options); err != nil {
+		t.Fatal(err)
+	}
+	_, body := last()
+	want := map[string]interface{}{"temperature": 0.0, "seed": 42.0, "num_predict": 100.0}
+	if !reflect.DeepEqual(body["options"], want) {
+		t.Errorf("options sent as %v, want %v", body["options"], want)
+	}
+
+	if _, err := client.Generate("m", "p"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := last(); body["options"] != nil || len(body) == 0 {
+		t.Errorf("sent %v, want no options field when none are set", body)
+	}
+}
+
+func TestChatSendsMessages(t *testing.T) {
+	captureLog(t)
+	server, last := recordingServer(t, `{"model":"m","message":{"role":"assistant","content":"4"},"done":true}`)
+	messages := []ChatMessage{
+		{Role: "system", Content: "Answer briefly."},
+		{Role: "user", Content: "What is 2+2?"},
+	}
+
+	reply, err := NewOllamaClient(serverAddr(server)).Chat("m", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != (ChatMessage{Role: "assistant", Content: "4"}) {
+		t.Errorf("reply %+v, want the assistant's 4", reply)
+	}
+
+	path, body := last()
+	if path != "/api/chat" {
+		t.Errorf("sent to %s, want /api/chat", path)
+	}
+	want := []interface{}{
+		map[string]interface{}{"role": "system", "content": "Answer briefly."},
+		map[string]interface{}{"role": "user", "content": "What is 2+2?"},
+	}
+	if !reflect.DeepEqual(body["messages"], want) || body["model"] != "m" || body["stream"] != false {
+		t.Errorf("sent %v, want model m, stream false and messages %v", body, want)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	captureLog(t)
+	server, last := recordingServer(t, `{"embedding":[0.5,-1,2.25]}`)
+
+	vector, err := NewOllamaClient(serverAddr(server)).Embeddings("m", "some code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.5, -1, 2.25}; !reflect.DeepEqual(vector, want) {
+		t.Errorf("got %v, want %v", vector, want)
+	}
+	if path, body := last(); path != "/api/embeddings" || body["prompt"] != "some code" {
+		t.Errorf("sent %v to %s, want the prompt sent to /api/embeddings", body, path)
+	}
+}
+
+func TestEmbeddingsErrors(t *testing.T) {
+	captureLog(t)
+	for _, test := range []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"error response", http.StatusNotFound, `{"error":"model \"m\" not found"}`, `status 404: model "m" not found`},
+		{"empty vector", http.StatusOK, `{"embedding":[]}`, "model m returned an empty embedding"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			vector, err := NewOllamaClient(serverAddr(server)).Embeddings("m", "p")
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("got %v, %v; want an error containing %q", vector, err, test.message)
+			}
+		})
+	}
+}
+
+func TestGenerateWithStats(t *testing.T) {
+	captureLog(t)
+	server := httptest.NewServer(jsonHandler(`{"model":"m","created_at":"2024-05-01T12:00:00Z","response":"hi","done":true,` +
+		`"context":[1,2,3],"total_duration":5000000000,"load_duration":1000000000,"prompt_eval_count":26,` +
+		`"prompt_eval_duration":500000000,"eval_count":290,"eval_duration":2000000000}`))
+	defer server.Close()
+
+	text, stats, err := NewOllamaClient(serverAddr(server)).GenerateWithStats("m", "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GenerateStats{
+		TotalDuration:      5 * time.Second,
+		LoadDuration:       time.Second,
+		PromptTokens:       26,
+		PromptEvalDuration: 500 * time.Millisecond,
+		ResponseTokens:     290,
+		EvalDuration:       2 * time.Second,
+	}
+	if text != "hi" || stats != want {
+		t.Errorf("got %q, %+v; want hi, %+v", text, stats, want)
+	}
+	if rate := stats.TokensPerSecond(); rate != 145 {
+		t.Errorf("%v tokens/sec, want 145", rate)
+	}
+}
+
+// pullProgress records the calls made to a PullModel progress callback
+type pullProgress []string
+
+func (p *pullProgress) record(status string, completed, total int64) {
+	*p = append(*p, fmt.Sprintf("%s %d/%d", status, completed, total))
+}
+
+func TestPullModelReportsProgress(t *testing.T) {
+	captureLog(t)
+	server := httptest.NewServer(jsonHandler(`{"status":"pulling manifest"}
+{"status":"downloading","digest":"sha256:ab","total":100,"completed":40}
+{"status":"downloading","digest":"sha256:ab","total":100,"completed":100}
+{"status":"success"}
+`))
+	defer server.Close()
+
+	var progress pullProgress
+	if err := NewOllamaClient(serverAddr(server)).PullModel("m", progress.record); err != nil {
+		t.Fatal(err)
+	}
+	want := pullProgress{"pulling manifest 0/0", "downloading 40/100", "downloading 100/100", "success 0/0"}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress %q, want %q", progress, want)
+	}
+}
+
+func TestPullModelFailures(t *testing.T) {
+	captureLog(t)
+	for _, test := range []struct {
+		name    string
+		body    string
+		calls   int
+		message string
+	}{
+		{"error mid-stream", "{\"status\":\"pulling manifest\"}\n{\"error\":\"disk full\"}\n{\"status\":\"success\"}\n", 1, "pull of m failed: disk full"},
+		{"no success", "{\"status\":\"pulling manifest\"}\n", 1, "pull of m ended without success"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(jsonHandler(test.body))
+			defer server.Close()
+
+			var progress pullProgress
+			err := NewOllamaClient(serverAddr(server)).PullModel("m", progress.record)
+			if err == nil || err.Error() != test.message {
+				t.Errorf("got %v, want %q", err, test.message)
+			}
+			if len(progress) != test.calls {
+				t.Errorf("progress %q, want %d call(s) before the failure", progress, test.calls)
+			}
+		})
+	}
+}
+
+func TestDumpNextRequest(t *testing.T) {
+	captureLog(t)
+	server, _ := recordingServer(t, `{"model":"m","response":"dumped","done":true}`)
+	client := NewOllamaClient(serverAddr(server))
+	dir := t.TempDir()
+
+	client.DumpNextRequest(dir)
+	if _, err := client.Generate("m", "first prompt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Generate("m", "second prompt"); err != nil {
+		t.Fatal(err)
+	}
+
+	requests, _ := filepath.Glob(filepath.Join(dir, "*-request.json"))
+	responses, _ := filepath.Glob(filepath.Join(dir, "*-response.json"))
+	if len(requests) != 1 || len(responses) != 1 {
+		t.Fatalf("dumped requests %v and responses %v, want one of each", requests, responses)
+	}
+	if id := strings.TrimSuffix(filepath.Base(requests[0]), "-request.json"); filepath.Base(responses[0]) != id+"-response.json" {
+		t.Errorf("request %s and response %s do not share a request ID", requests[0], responses[0])
+	}
+
+	request, err := os.ReadFile(requests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(request), "\n  \"prompt\": \"first prompt\",\n") {
+		t.Errorf("dumped request is not the pretty-printed first request:\n%s", request)
+	}
+	response, err := os.ReadFile(responses[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"model\": \"m\",\n  \"response\": \"dumped\",\n  \"done\": true\n}\n"; string(response) != want {
+		t.Errorf("dumped response %q, want %q", response, want)
+	}
+}
+
+func TestListModelsDetailed(t *testing.T) {
+	server := httptest.NewServer(jsonHandler(`{"models":[
+		{"name":"qwen3:30b","model":"qwen3:30b","modified_at":"2024-05-01T12:30:00.5+02:00","size":18556701140,"digest":"ab12cd","details":{"family":"qwen3"}},
+		{"name":"llama3:8b","modified_at":"2024-04-01T00:00:00Z","size":4661224676,"digest":"ef34"}
+	]}`))
+	defer server.Close()
+	client := NewOllamaClient(serverAddr(server))
+
+	models, err := client.ListModelsDetailed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ModelInfo{
+		{Name: "qwen3:30b", Size: 18556701140, Digest: "ab12cd", ModifiedAt: time.Date(2024, 5, 1, 10, 30, 0, 500000000, time.UTC)},
+		{Name: "llama3:8b", Size: 4661224676, Digest: "ef34", ModifiedAt: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(models) != len(want) {
+		t.Fatalf("got %+v, want %+v", models, want)
+	}
+	for i := range want {
+		if models[i].Name != want[i].Name || models[i].Size != want[i].Size || models[i].Digest != want[i].Digest || !models[i].ModifiedAt.Equal(want[i].ModifiedAt) {
+			t.Errorf("model %d is %+v, want %+v", i, models[i], want[i])
+		}
+	}
+
+	names, err := client.ListModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"qwen3:30b", "llama3:8b"}) {
+		t.Errorf("ListModels returned %q", names)
+	}
+}
+
+// streamHandler streams chunks as generate responses, one JSON object per
+// line, followed by a final done response carrying evalCount
+func streamHandler(evalCount int, chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoder := json.NewEncoder(w)
+		for _, chunk := range chunks {
+			encoder.Encode(GenerateResponse{Model: "m", Response: chunk})
+			w.(http.Flusher).Flush()
+		}
+		encoder.Encode(GenerateResponse{Model: "m", Done: true, Context: []int{1, 2}, EvalCount: evalCount})
+	}
+}
+
+func TestGenerateStreamFunc(t *testing.T) {
+	captureLog(t)
+	server := httptest.NewServer(streamHandler(3, "one ", "two ", "three"))
+	defer server.Close()
+	client := NewOllamaClient(serverAddr(server))
+
+	var chunks []string
+	err := client.GenerateStreamFunc("m", "p", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one ", "two ", "three", ""}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks %q, want %q", chunks, want)
+	}
+
+	errStop := errors.New("stop")
+	chunks = nil
+	err = client.GenerateStreamFunc("m", "p", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		if len(chunks) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("got %v, want the callback's error", err)
+	}
+	if want := []string{"one ", "two "}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks %q after stopping, want %q", chunks, want)
+	}
+}
+
+func TestClientOverHTTPS(t *testing.T) {
+	captureLog(t)
+	server := httptest.NewTLSServer(jsonHandler(`{"model":"m","response":"secure","done":true}`))
+	defer server.Close()
+	addrs := []string{serverAddr(server)}
+
+	client, err := NewOllamaClientWithOptions(addrs, WithScheme("https"), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := client.Generate("m", "p"); err != nil || response != "secure" {
+		t.Errorf("got %q, %v; want the response over TLS", response, err)
+	}
+
+	untrusted, err := NewOllamaClientWithOptions(addrs, WithScheme("https"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.Generate("m", "p"); err == nil {
+		t.Error("a client without the test certificate trusted the server")
+	}
+}
+
+func TestClientOptionsTimeout(t *testing.T) {
+	injected := &http.Client{Timeout: 5 * time.Second}
+	addrs := []string{"localhost:11434"}
+
+	for _, test := range []struct {
+		name string
+		opts []ClientOption
+		want time.Duration
+	}{
+		{"default", nil, defaultTimeout},
+		{"injected client", []ClientOption{WithHTTPClient(injected)}, 5 * time.Second},
+		{"injected client and timeout", []ClientOption{WithHTTPClient(injected), WithTimeout(time.Second)}, time.Second},
+		{"timeout", []ClientOption{WithTimeout(time.Minute)}, time.Minute},
+	} {
+		client, err := NewOllamaClientWithOptions(addrs, test.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if client.client.Timeout != test.want {
+			t.Errorf("%s: timeout %v, want %v", test.name, client.client.Timeout, test.want)
+		}
+	}
+	if injected.Timeout != 5*time.Second {
+		t.Errorf("the injected client was modified, timeout now %v", injected.Timeout)
+	}
+}
+
+func TestClientOptionsValidation(t *testing.T) {
+	for _, test := range []struct {
+		addrs []string
+		opts  []ClientOption
+	}{
+		{[]string{"localhost"}, nil},
+		{[]string{":11434"}, nil},
+		{[]string{"localhost:0"}, nil},
+		{[]string{"localhost:99999"}, nil},
+		{nil, nil},
+		{[]string{"localhost:11434"}, []ClientOption{WithScheme("ftp")}},
+		{[]string{"localhost:11434"}, []ClientOption{WithTimeout(-time.Second)}},
+	} {
+		if _, err := NewOllamaClientWithOptions(test.addrs, test.opts...); err == nil {
+			t.Errorf("accepted servers %q with %d option(s)", test.addrs, len(test.opts))
+		}
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	captureLog(t)
+	healthy := httptest.NewServer(jsonHandler(`{"version":"0.5.1"}`))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer unhealthy.Close()
+
+	for _, test := range []struct {
+		name string
+		addr string
+		want error
+	}{
+		{"down", downAddr(), ErrConnection},
+		{"unhealthy", serverAddr(unhealthy), ErrServer},
+		{"healthy", serverAddr(healthy), nil},
+	} {
+		err := NewOllamaClient(test.addr).HealthCheck()
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	version, err := NewOllamaClientWithServers([]string{serverAddr(unhealthy), serverAddr(healthy)}).Version()
+	if err != nil || version != "0.5.1" {
+		t.Errorf("Version() = %q, %v; want 0.5.1 from the healthy server", version, err)
+	}
+}
+
+func TestMaxConcurrentLimitsRequests(t *testing.T) {
+	captureLog(t)
+	var mu sync.Mutex
+	active, peak := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		w.Write([]byte(`{"model":"m","response":"ok","message":{"role":"assistant","content":"ok"},"done":true}`))
+	}))
+	defer server.Close()
+
+	const limit = 3
+	client, err := NewOllamaClientWithOptions([]string{serverAddr(server)}, WithMaxConcurrent(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 12)
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = client.Generate("m", "p")
+			} else {
+				_, err = client.Chat("m", []ChatMessage{{Role: "user", Content: "p"}})
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if peak > limit || peak < 2 {
+		t.Errorf("peak concurrency %d, want at most %d and some overlap", peak, limit)
+	}
+}
+
+func TestKeepAliveSent(t *testing.T) {
+	captureLog(t)
+	server, last := recordingServer(t, `{"model":"m","response":"ok","message":{"role":"assistant","content":"ok"},"done":true}`)
+
+	for _, test := range []struct {
+		keepAlive string
+		want      interface{}
+	}{
+		{"10m", "10m"},
+		{"-1", -1.0},
+	} {
+		client, err := NewOllamaClientWithOptions([]string{serverAddr(server)}, WithKeepAlive(test.keepAlive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Generate("m", "p"); err != nil {
+			t.Fatal(err)
+		}
+		if _, body := last(); body["keep_alive"] != test.want {
+			t.Errorf("generate sent keep_alive %#v, want %#v", body["keep_alive"], test.want)
+		}
+		if _, err := client.Chat("m", []ChatMessage{{Role: "user", Content: "p"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, body := last(); body["keep_alive"] != test.want {
+			t.Errorf("chat sent keep_alive %#v, want %#v", body["keep_alive"], test.want)
+		}
+	}
+
+	if _, err := NewOllamaClient(serverAddr(server)).Generate("m", "p"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := last(); body["keep_alive"] != nil {
+		t.Errorf("sent keep_alive %#v without the option", body["keep_alive"])
+	}
+	if _, err := NewOllamaClientWithOptions([]string{"localhost:11434"}, WithKeepAlive("forever")); err == nil {
+		t.Error("accepted keep-alive \"forever\"")
+	}
+}
+
+func TestGenerateWithSystemSendsSystem(t *testing.T) {
+	captureLog(t)
+	server, last := recordingServer(t, `{"model":"m","response":"ok","done":true}`)
+	client := NewOllamaClient(serverAddr(server))
+
+	if _, err := client.GenerateWithSystem("m", "You are a Go expert.", "p"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := last(); body["system"] != "You are a Go expert." || body["prompt"] != "p" {
+		t.Errorf("sent %v, want the system prompt separate from the prompt", body)
+	}
+
+	if _, err := client.Generate("m", "p"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := last(); body["system"] != nil {
+		t.Errorf("sent system %#v without one being given", body["system"])
+	}
+}
+
+func TestGenerateContinueRoundTripsContext(t *testing.T) {
+	captureLog(t)
+	server, last := recordingServer(t, `{"model":"m","response":"ok","done":true,"context":[4,5,6]}`)
+	client := NewOllamaClient(serverAddr(server))
+
+	text, history, err := client.GenerateContinue("m", "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "ok" || !reflect.DeepEqual(history, []int{4, 5, 6}) {
+		t.Errorf("got %q, %v; want the response text and context", text, history)
+	}
+	if _, body := last(); body["context"] != nil {
+		t.Errorf("sent context %v when starting a conversation", body["context"])
+	}
+
+	if _, _, err := client.GenerateContinue("m", "second", history); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := last(); !reflect.DeepEqual(body["context"], []interface{}{4.0, 5.0, 6.0}) {
+		t.Errorf("sent context %v, want the previous response's", body["context"])
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// promptData is the data available to prompt templates
+type promptData struct {
+	WorkspaceFiles string // listing of the workspace, one file per line
+	WorkspaceDir   string
+	ModelName      string
+	Target         Target
+}
+
+// defaultAnalyzePrompt is used when no analyze_prompt_path is configured
+const defaultAnalyzePrompt = `I have a workspace with {{.Target.Article}} {{.Target.Name}} implementation. Please analyze the current state and suggest next steps for improvement.
+
+Current workspace files:
+{{.WorkspaceFiles}}
+
+The goal is to have a complete, well-tested {{.Target.Name}}. Please:
+1. Analyze the current implementation
+2. Identify any gaps or areas for improvement  
+3. Suggest specific next steps
+4. Prioritize the most important improvements
+
+Please be specific and actionable in your suggestions.`
+
+// defaultFreshPrompt is used when no fresh_prompt_path is configured
+const defaultFreshPrompt = `Your task is to implement {{.Target.Article}} {{.Target.Name}} in Go with the following requirements:
+
+{{.Target.Requirements}}
+
+Please provide a complete Go implementation of the {{.Target.Name}}. Focus on correctness and clarity.
+Put each file in its own fenced code block with the filename after the language, for example ` + "```go main.go" + `.`
+
+// renderPrompt executes the text/template in the file at path, or the
+// built-in fallback when path is empty
+func (e *Engine) renderPrompt(path, fallback string) (string, error) {
+	text := fallback
+	name := "default"
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt template: %v", err)
+		}
+		text, name = string(data), path
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt template %s: %v", name, err)
+	}
+
+	data := promptData{
+		WorkspaceDir: e.config.WorkspaceDir,
+		ModelName:    e.config.ModelName,
+		Target:       e.config.Target,
+	}
+	var entries []workspaceEntry
+	if strings.Contains(text, ".WorkspaceFiles") {
+		if entries, err = e.scanWorkspace(); err != nil {
+			return "", fmt.Errorf("failed to scan workspace: %v", err)
+		}
+		data.WorkspaceFiles = fitListing(entries, noListingLimit)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %v", name, err)
+	}
+
+	// Cut the listing down by as much as the prompt is over budget
+	over := sb.Len() - e.config.MaxPromptChars
+	if e.config.MaxPromptChars <= 0 || over <= 0 || entries == nil {
+		return sb.String(), nil
+	}
+	limit := len(data.WorkspaceFiles) - over
+	if limit < 0 {
+		limit = 0
+	}
+	data.WorkspaceFiles = fitListing(entries, limit)
+	log.Printf("Prompt was %d characters, over the %d limit; shortened the workspace listing", sb.Len(), e.config.MaxPromptChars)
+
+	sb.Reset()
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %v", name, err)
+	}
+	return sb.String(), nil
+}
+
+// noListingLimit tells fitListing to render the whole listing
+const noListingLimit = -1
+
+// fitListing renders the workspace listing in at most maxChars bytes, or
+// in full if maxChars is noListingLimit. When it does not fit, the most
+// recently modified entries are kept, in their original order, followed by
+// a note of how many were left out; if not even the note fits, nothing is
+// listed.
+func fitListing(entries []workspaceEntry, maxChars int) string {
+	var full strings.Builder
+	for _, entry := range entries {
+		full.WriteString(entry.String())
+	}
+	if maxChars == noListingLimit || full.Len() <= maxChars {
+		return full.String()
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return entries[order[a]].modTime.After(entries[order[b]].modTime)
+	})
+
+	// Leave room for the note, sized for the largest possible count
+	used := len(omittedNote(len(entries)))
+	keep := make([]bool, len(entries))
+	kept := 0
+	for _, i := range order {
+		size := len(entries[i].String())
+		if used+size > maxChars {
+			break
+		}
+		used += size
+		keep[i] = true
+		kept++
+	}
+
+	var sb strings.Builder
+	for i, entry := range entries {
+		if keep[i] {
+			sb.WriteString(entry.String())
+		}
+	}
+	note := omittedNote(len(entries) - kept)
+	if sb.Len()+len(note) > maxChars {
+		return ""
+	}
+	sb.WriteString(note)
+	return sb.String()
+}
+
+// omittedNote tells the model that part of the listing was left out
+func omittedNote(count int) string {
+	return fmt.Sprintf("... %d more entries omitted to fit the prompt size limit (the most recently modified are shown)\n", count)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile creates a file under dir, with any missing parent directories
+func writeFile(t *testing.T, dir, path, content string) {
+	t.Helper()
+	fullPath := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderPromptFromFile(t *testing.T) {
+	e := newTestEngine(t)
+	e.config.ModelName = "qwen3:30b"
+	writeFile(t, e.config.WorkspaceDir, "main.go", "package main\n")
+	templatePath := filepath.Join(t.TempDir(), "fresh.tmpl")
+	writeFile(t, filepath.Dir(templatePath), "fresh.tmpl", "Build {{.Target.Article}} {{.Target.Name}} with {{.ModelName}} in {{.WorkspaceDir}}.\nFiles:\n{{.WorkspaceFiles}}")
+
+	prompt, err := e.renderPrompt(templatePath, defaultFreshPrompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Build a BASIC interpreter with qwen3:30b in " + e.config.WorkspaceDir + ".\nFiles:\n📄 main.go (13 bytes)\n"
+	if prompt != want {
+		t.Errorf("got %q, want %q", prompt, want)
+	}
+}
+
+func TestRenderPromptDefaultAndErrors(t *testing.T) {
+	e := newTestEngine(t)
+	prompt, err := e.renderPrompt("", defaultFreshPrompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(prompt, "Your task is to implement a BASIC interpreter in Go") || !strings.Contains(prompt, basicRequirements) {
+		t.Errorf("default prompt not rendered for the BASIC target:\n%s", prompt)
+	}
+
+	dir := t.TempDir()
+	writeFile(t, dir, "bad.tmpl", "{{.NoSuchField}}")
+	for _, path := range []string{filepath.Join(dir, "bad.tmpl"), filepath.Join(dir, "missing.tmpl")} {
+		if _, err := e.renderPrompt(path, defaultFreshPrompt); err == nil {
+			t.Errorf("%s rendered without error", path)
+		}
+	}
+}
+
+func TestPromptFitsBudget(t *testing.T) {
+	captureLog(t)
+	e := newTestEngine(t)
+	e.config.MaxPromptChars = 4000
+	writeTree(t, e.config.WorkspaceDir, 2000)
+	newest := filepath.Join(e.config.WorkspaceDir, "pkg0", "file0.go")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(newest, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt, err := e.renderPrompt("", defaultAnalyzePrompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompt) > e.config.MaxPromptChars {
+		t.Errorf("prompt is %d characters, over the %d budget", len(prompt), e.config.MaxPromptChars)
+	}
+	if !strings.Contains(prompt, "more entries omitted to fit the prompt size limit") {
+		t.Errorf("prompt does not note the omitted entries:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, filepath.Join("pkg0", "file0.go")) {
+		t.Errorf("the most recently modified file was left out")
+	}
+}
+
+func TestFitListing(t *testing.T) {
+	now := time.Now()
+	var entries []workspaceEntry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, workspaceEntry{path: fmt.Sprintf("pkg/file%d.go", i), size: 100, modTime: now.Add(time.Duration(i%5) * time.Minute)})
+	}
+	full := fitListing(entries, noListingLimit)
+	if !strings.HasPrefix(full, "📄 pkg/file0.go (100 bytes)\n📄 pkg/file1.go (100 bytes)\n") || strings.Count(full, "\n") != 10 {
+		t.Errorf("full listing %q", full)
+	}
+	if got := fitListing(entries, len(full)); got != full {
+		t.Errorf("listing that fits was changed to %q", got)
+	}
+
+	// Files 4 and 9 are the newest; a tie keeps the earlier one
+	got := fitListing(entries, len(omittedNote(10))+len(entries[4].String()))
+	if want := entries[4].String() + omittedNote(9); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got = fitListing(entries, len(omittedNote(10))+2*len(entries[4].String()))
+	if want := entries[4].String() + entries[9].String() + omittedNote(8); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := fitListing(entries, 0); got != "" {
+		t.Errorf("zero budget listed %q", got)
+	}
+}
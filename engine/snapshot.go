@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// saveSnapshot writes snapshot to path as JSON. The file is written under
+// a temporary name and then renamed, so an interrupted run never leaves a
+// truncated snapshot behind.
+func saveSnapshot(path string, snapshot WorkspaceSnapshot) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %v", err)
+	}
+	tmpPath := file.Name()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot file: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save snapshot file: %v", err)
+	}
+	return nil
+}
+
+// loadSnapshot reads a snapshot written by saveSnapshot
+func loadSnapshot(path string) (WorkspaceSnapshot, error) {
+	var snapshot WorkspaceSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("failed to parse snapshot file %s: %v", path, err)
+	}
+	if snapshot.Files == nil {
+		snapshot.Files = make(map[string]FileInfo)
+	}
+	if snapshot.HashAlgorithm == "" {
+		snapshot.HashAlgorithm = defaultHashAlgorithm
+	}
+	return snapshot, nil
+}
+
+// baselineSnapshot returns the snapshot the run's changes are reported
+// against. Without baseline_path that is a fresh snapshot. Otherwise the
+// stored baseline is loaded, or taken and saved if there is none yet, so
+// the report covers every run since the baseline was captured.
+func (e *Engine) baselineSnapshot() (WorkspaceSnapshot, error) {
+	path := e.config.BaselinePath
+	if path == "" {
+		return e.takeWorkspaceSnapshot()
+	}
+
+	snapshot, err := loadSnapshot(path)
+	switch {
+	case err == nil && snapshot.HashAlgorithm == e.hashAlgorithm():
+		log.Printf("Using baseline snapshot from %s (taken %s)", path, snapshot.Timestamp.Format("2006-01-02 15:04:05"))
+		return snapshot, nil
+	case err == nil:
+		log.Printf("Warning: baseline %s was hashed with %s, not %s; taking a new baseline", path, snapshot.HashAlgorithm, e.hashAlgorithm())
+	case !os.IsNotExist(err):
+		return snapshot, err
+	}
+
+	if snapshot, err = e.takeWorkspaceSnapshot(); err != nil {
+		return snapshot, err
+	}
+	if err := saveSnapshot(path, snapshot); err != nil {
+		log.Printf("Warning: failed to save baseline snapshot: %v", err)
+	} else {
+		log.Printf("Saved baseline snapshot to %s", path)
+	}
+	return snapshot, nil
+}
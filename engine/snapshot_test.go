@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	e := newTestEngine(t)
+	writeFile(t, e.config.WorkspaceDir, "main.go", "package main\n")
+	writeFile(t, e.config.WorkspaceDir, "tests/basic/hello.bas", "10 PRINT \"HI\"\n")
+	snapshot, err := e.takeWorkspaceSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := saveSnapshot(path, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Timestamp.Equal(snapshot.Timestamp) || loaded.HashAlgorithm != snapshot.HashAlgorithm || len(loaded.Files) != len(snapshot.Files) {
+		t.Fatalf("loaded %+v, want %+v", loaded, snapshot)
+	}
+	for path, file := range snapshot.Files {
+		got := loaded.Files[path]
+		if !got.ModTime.Equal(file.ModTime) {
+			t.Errorf("%s mod time %v, want %v", path, got.ModTime, file.ModTime)
+		}
+		got.ModTime = file.ModTime
+		if !reflect.DeepEqual(got, file) {
+			t.Errorf("%s loaded as %+v, want %+v", path, got, file)
+		}
+	}
+
+	report := e.generateWorkspaceReport(loaded, snapshot)
+	if len(report.Added)+len(report.Removed)+len(report.Modified) != 0 {
+		t.Errorf("reloaded snapshot differs from the original: %s", report.Summary)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("left %d files beside the snapshot", len(entries)-1)
+	}
+}
+
+func TestBaselineSnapshotReused(t *testing.T) {
+	captureLog(t)
+	e := newTestEngine(t)
+	e.config.BaselinePath = filepath.Join(t.TempDir(), "baseline.json")
+	writeFile(t, e.config.WorkspaceDir, "main.go", "package main\n")
+
+	first, err := e.baselineSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, e.config.WorkspaceDir, "added.go", "package main\n")
+	second, err := e.baselineSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Timestamp.Equal(first.Timestamp) || len(second.Files) != 1 {
+		t.Errorf("second run got a new baseline with %d files, want the stored one", len(second.Files))
+	}
+
+	e.config.HashAlgorithm = "sha256"
+	third, err := e.baselineSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.HashAlgorithm != "sha256" || len(third.Files) != 2 {
+		t.Errorf("changing the hash algorithm kept the %s baseline with %d files", third.HashAlgorithm, len(third.Files))
+	}
+}
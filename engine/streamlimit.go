@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// StreamLimits caps a streamed generation so a runaway model cannot
+// produce megabytes of output. Zero fields impose no limit.
+type StreamLimits struct {
+	MaxBytes    int           // response text length
+	MaxDuration time.Duration // time from sending the request
+}
+
+// errStreamLimit is returned from the chunk callback to stop the stream
+// once MaxBytes is reached
+var errStreamLimit = errors.New("response size limit reached")
+
+// DoStreamLimited is DoStream with limits. When a limit is reached the
+// request is cancelled and the text received so far is returned with
+// truncated set and no error; onChunk never sees text beyond MaxBytes,
+// which is cut between characters. The partial response has no final
+// metrics or context.
+func DoStreamLimited(ctx context.Context, generator StreamingGenerator, req GenerateRequest, limits StreamLimits, onChunk func(string) error) (response GenerateResponse, truncated bool, err error) {
+	limitCtx := ctx
+	if limits.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		limitCtx, cancel = context.WithTimeout(ctx, limits.MaxDuration)
+		defer cancel()
+	}
+
+	var text strings.Builder
+	response, err = generator.DoStream(limitCtx, req, func(chunk string) error {
+		limited := limits.MaxBytes > 0 && text.Len()+len(chunk) > limits.MaxBytes
+		if limited {
+			chunk = cutAtRune(chunk, limits.MaxBytes-text.Len())
+		}
+		text.WriteString(chunk)
+		if chunk != "" {
+			if err := onChunk(chunk); err != nil {
+				return err
+			}
+		}
+		if limited {
+			return errStreamLimit
+		}
+		return nil
+	})
+
+	timedOut := limitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+	if errors.Is(err, errStreamLimit) || (err != nil && timedOut) {
+		return GenerateResponse{Model: req.Model, Response: text.String()}, true, nil
+	}
+	return response, false, err
+}
+
+// cutAtRune returns the longest prefix of s of at most n bytes that does
+// not split a UTF-8 sequence
+func cutAtRune(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// streamLimits converts the configured response limits
+func (c *Config) streamLimits() (StreamLimits, error) {
+	limits := StreamLimits{MaxBytes: c.MaxResponseBytes}
+	if c.MaxResponseTime != "" {
+		d, err := time.ParseDuration(c.MaxResponseTime)
+		if err != nil {
+			return limits, fmt.Errorf("bad max_response_time: %v", err)
+		}
+		limits.MaxDuration = d
+	}
+	return limits, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// chunkGenerator streams its chunks in turn
+type chunkGenerator struct {
+	fakeRequestGenerator
+	chunks []string
+}
+
+func (g *chunkGenerator) DoStream(ctx context.Context, req GenerateRequest, onChunk func(string) error) (GenerateResponse, error) {
+	for _, chunk := range g.chunks {
+		if err := onChunk(chunk); err != nil {
+			return GenerateResponse{}, err
+		}
+	}
+	return GenerateResponse{Model: req.Model, Response: strings.Join(g.chunks, ""), Done: true, EvalCount: len(g.chunks)}, nil
+}
+
+func TestDoStreamLimitedCutsBetweenCharacters(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		chunks    []string
+		maxBytes  int
+		want      string
+		truncated bool
+	}{
+		{"no limit", []string{"héllo", " wörld"}, 0, "héllo wörld", false},
+		{"under the limit", []string{"héllo", " wörld"}, 100, "héllo wörld", false},
+		{"at a boundary", []string{"héllo", " wörld"}, 8, "héllo w", true},
+		{"inside a two-byte character", []string{"héllo", " wörld"}, 9, "héllo w", true},
+		{"inside a four-byte character", []string{"ok ", "🙂🙂"}, 5, "ok ", true},
+		{"inside the first character", []string{"日本"}, 2, "", true},
+	} {
+		generator := &chunkGenerator{chunks: test.chunks}
+		var seen strings.Builder
+		response, truncated, err := DoStreamLimited(context.Background(), generator, GenerateRequest{Model: "m"}, StreamLimits{MaxBytes: test.maxBytes}, func(chunk string) error {
+			if !utf8.ValidString(chunk) {
+				t.Errorf("%s: onChunk got invalid UTF-8 %q", test.name, chunk)
+			}
+			seen.WriteString(chunk)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if response.Response != test.want || truncated != test.truncated {
+			t.Errorf("%s: got %q truncated %v, want %q truncated %v", test.name, response.Response, truncated, test.want, test.truncated)
+		}
+		if !utf8.ValidString(response.Response) {
+			t.Errorf("%s: response %q is not valid UTF-8", test.name, response.Response)
+		}
+		if seen.String() != response.Response {
+			t.Errorf("%s: onChunk saw %q, response is %q", test.name, seen.String(), response.Response)
+		}
+	}
+}
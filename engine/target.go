@@ -0,0 +1,42 @@
+package main
+
+import "strings"
+
+// Target describes the project the engine develops. The generated Go files
+// are built into Artifact and TestCommand is run in the workspace to check
+// them; a nonzero exit status means the tests failed.
+type Target struct {
+	Name         string   `json:"name"`         // what is being built, e.g. "BASIC interpreter"
+	Artifact     string   `json:"artifact"`     // executable path relative to the workspace
+	TestCommand  []string `json:"test_command"` // program and arguments, run in the workspace
+	Requirements string   `json:"requirements"` // the task description given to the model for fresh development
+}
+
+// basicRequirements is the task description for the default target
+const basicRequirements = `1. Support line-numbered BASIC syntax (classic style)
+2. Implement core statements: PRINT, LET, GOTO, IF-THEN, FOR-NEXT, REM, END
+3. Support variables (both numeric and string)
+4. Include proper error handling
+5. Accept filename as command line argument
+
+The interpreter should be compatible with test files that exist in tests/basic/ directory.
+You may add new test programs under tests/basic/; declare each line of a program's expected output with a
+directive such as 10 REM @expect-output Hello and the expected output file will be generated for you.`
+
+// defaultTarget is the BASIC interpreter the engine was written for
+func defaultTarget() Target {
+	return Target{
+		Name:         "BASIC interpreter",
+		Artifact:     "basic",
+		TestCommand:  []string{"go", "run", "test_runner.go", "-no-color", "./basic"},
+		Requirements: basicRequirements,
+	}
+}
+
+// Article returns "a" or "an" to go before the target name in prompts
+func (t Target) Article() string {
+	if t.Name != "" && strings.ContainsRune("AEIOUaeiou", rune(t.Name[0])) {
+		return "an"
+	}
+	return "a"
+}
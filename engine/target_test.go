@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfiguredTarget(t *testing.T) {
+	captureLog(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "config.json", `{
+		"workspace_dir": "`+filepath.ToSlash(filepath.Join(dir, "ws"))+`",
+		"target": {"name": "JSON formatter", "artifact": "bin/jsonfmt", "test_command": ["./bin/jsonfmt", "-selftest"], "requirements": "Pretty-print JSON from stdin."}
+	}`)
+	config, err := loadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Target{Name: "JSON formatter", Artifact: "bin/jsonfmt", TestCommand: []string{"./bin/jsonfmt", "-selftest"}, Requirements: "Pretty-print JSON from stdin."}
+	if !reflect.DeepEqual(config.Target, want) {
+		t.Errorf("target %+v, want %+v", config.Target, want)
+	}
+
+	generator := &fakeGenerator{responses: []string{"no code", "Looks fine."}}
+	e := &Engine{config: config, generator: generator, output: &strings.Builder{}}
+	config.MaxIterations = 1
+
+	if err := e.startDevelopmentSession(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(generator.prompts[0], "implement a JSON formatter in Go with the following requirements:\n\nPretty-print JSON from stdin.") {
+		t.Errorf("fresh prompt does not name the target:\n%s", generator.prompts[0])
+	}
+	if !strings.Contains(generator.prompts[0], "You are an expert Go developer building a JSON formatter.") {
+		t.Errorf("system prompt does not name the target:\n%s", generator.prompts[0])
+	}
+
+	writeFile(t, config.WorkspaceDir, "bin/jsonfmt", "")
+	if err := e.startDevelopmentSession(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(generator.prompts[1], "I have a workspace with a JSON formatter implementation") {
+		t.Errorf("existing bin/jsonfmt not analyzed:\n%s", generator.prompts[1])
+	}
+}
+
+func TestPartialTargetKeepsDefaults(t *testing.T) {
+	captureLog(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "config.json", `{"target": {"artifact": "basic2"}}`)
+	config, err := loadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultTarget()
+	want.Artifact = "basic2"
+	if !reflect.DeepEqual(config.Target, want) {
+		t.Errorf("target %+v, want the defaults with artifact basic2", config.Target)
+	}
+}
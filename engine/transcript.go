@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// transcript records the prompts, responses and outcomes of an engine run
+// as a Markdown file in the workspace. Its methods do nothing on a nil
+// transcript, so callers need not check whether one is being written.
+type transcript struct {
+	file *os.File
+	name string
+	err  error
+}
+
+// newTranscript creates transcript-<timestamp>.md in dir
+func newTranscript(dir, model string, start time.Time) (*transcript, error) {
+	name := fmt.Sprintf("transcript-%s.md", start.Format("20060102-150405"))
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &transcript{file: file, name: name}
+	t.write("# Engine transcript\n\n")
+	t.write(fmt.Sprintf("- Started: %s\n- Model: %s\n", start.Format("2006-01-02 15:04:05"), model))
+	return t, nil
+}
+
+// write appends text, logging only the first failure
+func (t *transcript) write(text string) {
+	if t == nil || t.err != nil {
+		return
+	}
+	if _, t.err = t.file.WriteString(text); t.err != nil {
+		log.Printf("Warning: failed to write transcript %s: %v", t.name, t.err)
+	}
+}
+
+// section starts a new top-level section, such as an iteration
+func (t *transcript) section(title string) {
+	t.write(fmt.Sprintf("\n## %s\n\n", title))
+}
+
+// generation records one prompt and the model's response
+func (t *transcript) generation(prompt, response string, duration time.Duration, err error) {
+	t.write("### Prompt\n\n" + fence(prompt) + "\n")
+	if err != nil {
+		t.write(fmt.Sprintf("### Response (failed after %s)\n\n%v\n\n", duration.Round(time.Millisecond), err))
+		return
+	}
+	t.write(fmt.Sprintf("### Response (%s)\n\n", duration.Round(time.Millisecond)) + fence(response) + "\n")
+}
+
+// note records a single line of outcome, such as the files written
+func (t *transcript) note(format string, args ...interface{}) {
+	t.write("- " + fmt.Sprintf(format, args...) + "\n")
+}
+
+// close finishes the transcript with the total duration
+func (t *transcript) close(start time.Time) {
+	if t == nil {
+		return
+	}
+	t.write(fmt.Sprintf("\n---\n\nFinished after %s\n", time.Since(start).Round(time.Second)))
+	if err := t.file.Close(); err != nil && t.err == nil {
+		log.Printf("Warning: failed to close transcript %s: %v", t.name, err)
+	}
+}
+
+// fence wraps text in a code fence longer than any backtick run inside it,
+// so code blocks in prompts and responses are kept intact
+func fence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	marker := strings.Repeat("`", max(3, longest+1))
+	return marker + "\n" + strings.TrimRight(text, "\n") + "\n" + marker + "\n"
+}
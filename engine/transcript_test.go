@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscriptRecordsIterations(t *testing.T) {
+	captureLog(t)
+	generator := &fakeGenerator{responses: []string{goProgram("\tos.Exit(1)"), goProgram("")}}
+	e := newIteratingEngine(t, generator, 3)
+	start := time.Now()
+	var err error
+	if e.transcript, err = newTranscript(e.config.WorkspaceDir, "qwen3:30b", start); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.developIteratively("build a tool"); err != nil {
+		t.Fatal(err)
+	}
+	e.transcript.close(start)
+
+	content, err := os.ReadFile(filepath.Join(e.config.WorkspaceDir, "transcript-"+start.Format("20060102-150405")+".md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"# Engine transcript\n",
+		"- Started: " + start.Format("2006-01-02 15:04:05") + "\n- Model: qwen3:30b\n",
+		"\n## Iteration 1 of 3\n",
+		"### Prompt\n\n```\nbuild a tool\n```\n",
+		"### Response (",
+		"````\n```go main.go\n",
+		"- Wrote 1 file(s): main.go\n",
+		"- Build succeeded\n",
+		"- Tests failed\n",
+		"\n## Iteration 2 of 3\n",
+		"### Prompt\n\n````\nHere is the current implementation:",
+		"- All tests passed\n",
+		"\n---\n\nFinished after ",
+	}
+	rest := string(content)
+	for _, section := range want {
+		i := strings.Index(rest, section)
+		if i < 0 {
+			t.Fatalf("transcript lacks %q after the earlier sections:\n%s", section, content)
+		}
+		rest = rest[i+len(section):]
+	}
+}
+
+func TestFenceEnclosesBackticks(t *testing.T) {
+	if got := fence("plain"); got != "```\nplain\n```\n" {
+		t.Errorf("got %q", got)
+	}
+	if got := fence("```go\ncode\n```\n"); got != "````\n```go\ncode\n```\n````\n" {
+		t.Errorf("got %q", got)
+	}
+}
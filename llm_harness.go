@@ -0,0 +1,579 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Shared by the LLM test harnesses; run with
+// go run test_llm.go llm_harness.go
+// or go run test_llm_advanced.go llm_harness.go
+
+type TestRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+}
+
+type TestResponse struct {
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+	Response  string    `json:"response"`
+	Done      bool      `json:"done"`
+
+	// Set by streamPrompt when a limit cut the response short; not part
+	// of the API
+	Truncated bool `json:"-"`
+}
+
+// promptResult holds the outcome of a single prompt
+type promptResult struct {
+	Index    int
+	Prompt   string
+	Server   string
+	Response TestResponse
+	Duration time.Duration // including any retries
+	Attempts int
+	Err      error
+}
+
+// Retry backoff: the delay grows by baseDelay per attempt up to maxDelay
+const (
+	baseDelay = time.Second
+	maxDelay  = 30 * time.Second
+)
+
+// retryWithBackoff runs operation until it succeeds or has been retried
+// retries times, returning the number of attempts made and the last error.
+// A negative retries retries forever.
+func retryWithBackoff(retries int, operation func() error, description string) (int, error) {
+	var lastErr error
+	for attempt := 0; retries < 0 || attempt <= retries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(attempt) * baseDelay
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+			log.Printf("Retry attempt %d for %s after %v delay (last error: %v)",
+				attempt+1, description, delay, lastErr)
+			time.Sleep(delay)
+		}
+
+		if err := operation(); err != nil {
+			lastErr = err
+			continue
+		}
+
+		if attempt > 0 {
+			log.Printf("Successfully completed %s after %d attempts", description, attempt+1)
+		}
+		return attempt + 1, nil
+	}
+	return retries + 1, lastErr
+}
+
+// sendPrompt sends one non-streaming generate request and parses the reply
+func sendPrompt(client *http.Client, baseURL string, req TestRequest) (TestResponse, error) {
+	var response TestResponse
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return response, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := client.Post(
+		baseURL+"/api/generate",
+		"application/json",
+		bytes.NewBuffer(jsonData),
+	)
+	if err != nil {
+		return response, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	if err != nil {
+		return response, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return response, nil
+}
+
+// runPrompts sends each prompt with send, retrying failures as
+// retryWithBackoff does and running workers prompts at once on each server;
+// idle workers take the next unsent prompt. send may be called from several
+// goroutines. onResult is called with each result as soon as its prompt
+// finishes, one call at a time. All results are returned in prompt order.
+func runPrompts(baseURLs []string, workers, retries int, prompts []string, send func(baseURL string, i int) (TestResponse, error), onResult func(promptResult)) []promptResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]promptResult, len(prompts))
+	next := make(chan int, len(prompts))
+	for i := range prompts {
+		next <- i
+	}
+	close(next)
+
+	var mu sync.Mutex // serializes onResult
+	var wg sync.WaitGroup
+	for w := 0; w < workers*len(baseURLs); w++ {
+		wg.Add(1)
+		go func(baseURL string) {
+			defer wg.Done()
+			for i := range next {
+				var response TestResponse
+				start := time.Now()
+				attempts, err := retryWithBackoff(retries, func() error {
+					var err error
+					response, err = send(baseURL, i)
+					return err
+				}, fmt.Sprintf("prompt %d", i+1))
+				results[i] = promptResult{
+					Index:    i,
+					Prompt:   prompts[i],
+					Server:   baseURL,
+					Response: response,
+					Duration: time.Since(start),
+					Attempts: attempts,
+					Err:      err,
+				}
+				mu.Lock()
+				onResult(results[i])
+				mu.Unlock()
+			}
+		}(baseURLs[w%len(baseURLs)])
+	}
+	wg.Wait()
+
+	return results
+}
+
+// listFlag is a flag that may be repeated or given a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// comparisonTable lays out the same prompt set run against each model side
+// by side: one row per prompt with each model's duration and response
+// length, then the averages over each model's successful prompts. results
+// holds one slice per model, in prompt order.
+func comparisonTable(models []string, results [][]promptResult) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+
+	fmt.Fprint(w, "#\tPrompt")
+	for _, model := range models {
+		fmt.Fprintf(w, "\t%s time\t%s chars", model, model)
+	}
+	fmt.Fprintln(w)
+
+	totals := make([]time.Duration, len(models))
+	lengths := make([]int, len(models))
+	counts := make([]int, len(models))
+	for i := range results[0] {
+		fmt.Fprintf(w, "%d\t%s", i+1, truncateString(results[0][i].Prompt, 40))
+		for m := range models {
+			result := results[m][i]
+			if result.Err != nil {
+				fmt.Fprint(w, "\tfailed\t-")
+				continue
+			}
+			fmt.Fprintf(w, "\t%v\t%d", result.Duration.Round(time.Millisecond), len(result.Response.Response))
+			totals[m] += result.Duration
+			lengths[m] += len(result.Response.Response)
+			counts[m]++
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, "\tAverage")
+	for m := range models {
+		if counts[m] == 0 {
+			fmt.Fprint(w, "\t-\t-")
+			continue
+		}
+		fmt.Fprintf(w, "\t%v\t%d", (totals[m] / time.Duration(counts[m])).Round(time.Millisecond), lengths[m]/counts[m])
+	}
+	fmt.Fprintln(w)
+
+	w.Flush()
+	return sb.String()
+}
+
+// loadPrompts reads a prompt set from path. A file starting with '[' is a
+// JSON array of strings; otherwise each non-blank line is one prompt, and
+// lines starting with '#' are comments.
+func loadPrompts(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompts file: %v", err)
+	}
+
+	var prompts []string
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &prompts); err != nil {
+			return nil, fmt.Errorf("failed to parse prompts file %s as a JSON array: %v", path, err)
+		}
+	} else {
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				prompts = append(prompts, line)
+			}
+		}
+	}
+
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("no prompts found in %s", path)
+	}
+	return prompts, nil
+}
+
+// promptMetric is one row of the -out metrics file
+type promptMetric struct {
+	Model          string  `json:"model,omitempty"`
+	Prompt         string  `json:"prompt"` // truncated to metricPromptLength
+	PromptLength   int     `json:"prompt_length"`
+	DurationMs     float64 `json:"duration_ms"`
+	ResponseLength int     `json:"response_length"`
+	Success        bool    `json:"success"`
+	Truncated      bool    `json:"truncated"`
+	HasFunc        bool    `json:"has_func"`
+	HasPackage     bool    `json:"has_package"`
+	HasImport      bool    `json:"has_import"`
+	HasReturn      bool    `json:"has_return"`
+	HasGoFence     bool    `json:"has_go_fence"`
+}
+
+// metricPromptLength is how much of each prompt the metrics file keeps
+const metricPromptLength = 60
+
+// newPromptMetric builds the metrics row for one prompt. A failed prompt
+// has err set and no response; truncated marks a response cut short by the
+// stream limits.
+func newPromptMetric(prompt, response string, truncated bool, duration time.Duration, err error) promptMetric {
+	short := prompt
+	if len(short) > metricPromptLength {
+		short = short[:metricPromptLength] + "..."
+	}
+	signals := detectCodeSignals(response)
+	return promptMetric{
+		Prompt:         short,
+		PromptLength:   len(prompt),
+		DurationMs:     float64(duration) / float64(time.Millisecond),
+		ResponseLength: len(response),
+		Success:        err == nil,
+		Truncated:      truncated,
+		HasFunc:        signals.Func,
+		HasPackage:     signals.Package,
+		HasImport:      signals.Import,
+		HasReturn:      signals.Return,
+		HasGoFence:     signals.GoFence,
+	}
+}
+
+// codeSignals records which markers of Go code a response contains, as a
+// heuristic for whether the model actually produced code
+type codeSignals struct {
+	Func, Package, Import, Return, GoFence bool
+}
+
+var (
+	goFencePattern = regexp.MustCompile("(?m)^\\s*```(go|golang)\\s*$")
+	funcPattern    = regexp.MustCompile(`\bfunc\b`)
+	packagePattern = regexp.MustCompile(`(?m)^\s*package\s+\w+`)
+	importPattern  = regexp.MustCompile(`(?m)^\s*import\s+[("]`)
+	returnPattern  = regexp.MustCompile(`\breturn\b`)
+)
+
+// detectCodeSignals checks response for each signal. Keywords must be whole
+// words, and package and import must start a line, so prose such as
+// "functions" or "the package manager" does not count.
+func detectCodeSignals(response string) codeSignals {
+	return codeSignals{
+		Func:    funcPattern.MatchString(response),
+		Package: packagePattern.MatchString(response),
+		Import:  importPattern.MatchString(response),
+		Return:  returnPattern.MatchString(response),
+		GoFence: goFencePattern.MatchString(response),
+	}
+}
+
+// String lists the signals found, e.g. "func, package, ```go block (3/5)"
+func (s codeSignals) String() string {
+	var found []string
+	for _, signal := range []struct {
+		present bool
+		name    string
+	}{
+		{s.Func, "func"},
+		{s.Package, "package"},
+		{s.Import, "import"},
+		{s.Return, "return"},
+		{s.GoFence, "```go block"},
+	} {
+		if signal.present {
+			found = append(found, signal.name)
+		}
+	}
+	if len(found) == 0 {
+		return "none (0/5)"
+	}
+	return fmt.Sprintf("%s (%d/5)", strings.Join(found, ", "), len(found))
+}
+
+// writeMetrics saves the rows to path, as a JSON array if the name ends in
+// .json and as CSV with a header row otherwise
+func writeMetrics(path string, metrics []promptMetric) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %v", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if metrics == nil {
+			metrics = []promptMetric{}
+		}
+		if err := encoder.Encode(metrics); err != nil {
+			return fmt.Errorf("failed to write metrics file: %v", err)
+		}
+		return file.Close()
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"model", "prompt", "prompt_length", "duration_ms", "response_length", "success", "truncated",
+		"has_func", "has_package", "has_import", "has_return", "has_go_fence"})
+	for _, m := range metrics {
+		w.Write([]string{
+			m.Model,
+			m.Prompt,
+			strconv.Itoa(m.PromptLength),
+			strconv.FormatFloat(m.DurationMs, 'f', 1, 64),
+			strconv.Itoa(m.ResponseLength),
+			strconv.FormatBool(m.Success),
+			strconv.FormatBool(m.Truncated),
+			strconv.FormatBool(m.HasFunc),
+			strconv.FormatBool(m.HasPackage),
+			strconv.FormatBool(m.HasImport),
+			strconv.FormatBool(m.HasReturn),
+			strconv.FormatBool(m.HasGoFence),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+	return file.Close()
+}
+
+// Server and model defaults, overridden by the OLLAMA_SERVER and MODEL_NAME
+// environment variables, which are in turn overridden by -server and -model
+const (
+	defaultServer = "192.168.0.63:11434"
+	defaultModel  = "qwen3:30b"
+	serverEnv     = "OLLAMA_SERVER"
+	modelEnv      = "MODEL_NAME"
+)
+
+// reachTimeout bounds the reachability check, so a wrong address fails fast
+// rather than hanging before the first prompt
+const reachTimeout = 10 * time.Second
+
+// resolveSetting returns the flag value if set, else the environment
+// variable if set, else the default
+func resolveSetting(flagValue, envName, def string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if v := strings.TrimSpace(os.Getenv(envName)); v != "" {
+		return v
+	}
+	return def
+}
+
+// serverURLs turns a comma-separated server list into base URLs. Addresses
+// without a scheme get http://.
+func serverURLs(servers string) []string {
+	var urls []string
+	for _, addr := range strings.Split(servers, ",") {
+		addr = strings.TrimRight(strings.TrimSpace(addr), "/")
+		if addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		urls = append(urls, addr)
+	}
+	return urls
+}
+
+// checkServer confirms an Ollama server answers /api/tags and returns how
+// long it took
+func checkServer(baseURL string) (time.Duration, error) {
+	client := &http.Client{Timeout: reachTimeout}
+	start := time.Now()
+	resp, err := client.Get(baseURL + "/api/tags")
+	if err != nil {
+		return 0, fmt.Errorf("server %s is not reachable (set -server or %s): %v", baseURL, serverEnv, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("server %s health check failed with status %d", baseURL, resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
+
+// streamLimits cut a streamed response short; zero fields impose no limit
+type streamLimits struct {
+	maxBytes    int
+	maxDuration time.Duration
+}
+
+// streamPrompt sends a streaming generate request and assembles the chunks
+// into one response, calling progress after each chunk with the counts so
+// far. When a limit is reached the request is cancelled and the text so far
+// is returned with Truncated set and no error; a size cut falls between
+// characters.
+func streamPrompt(client *http.Client, baseURL string, req TestRequest, limits streamLimits, progress func(chunks, chars int)) (TestResponse, error) {
+	response := TestResponse{Model: req.Model}
+	ctx, cancel := context.WithCancel(context.Background())
+	if limits.maxDuration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), limits.maxDuration)
+	}
+	defer cancel()
+
+	req.Stream = true
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return response, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return response, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	// The time limit counts as truncation wherever it expires, even before
+	// the first chunk, so it is never retried as a failure
+	var text strings.Builder
+	truncate := func() (TestResponse, error) {
+		response.Response = text.String()
+		response.Truncated = true
+		return response, nil
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return truncate()
+		}
+		return response, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if ctx.Err() == context.DeadlineExceeded {
+			return truncate()
+		}
+		return response, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for chunks := 1; ; chunks++ {
+		var chunk TestResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return truncate()
+			}
+			if err == io.EOF {
+				return response, fmt.Errorf("stream ended before the final chunk")
+			}
+			return response, fmt.Errorf("failed to parse response: %v", err)
+		}
+		if limits.maxBytes > 0 && text.Len()+len(chunk.Response) > limits.maxBytes {
+			text.WriteString(cutAtRune(chunk.Response, limits.maxBytes-text.Len()))
+			progress(chunks, text.Len())
+			return truncate()
+		}
+		text.WriteString(chunk.Response)
+		progress(chunks, text.Len())
+		if chunk.Done {
+			response = chunk
+			response.Response = text.String()
+			return response, nil
+		}
+	}
+}
+
+// cutAtRune returns the longest prefix of s of at most n bytes that does
+// not split a UTF-8 sequence
+func cutAtRune(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// progressInterval is the least time between streaming progress lines
+const progressInterval = 5 * time.Second
+
+// progressLogger returns a streamPrompt progress callback that logs the
+// chunk and character counts for label at most every progressInterval
+func progressLogger(label string) func(chunks, chars int) {
+	last := time.Now()
+	return func(chunks, chars int) {
+		if time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		log.Printf("%s: %d chunks, %d characters so far", label, chunks, chars)
+	}
+}
+
+func truncateString(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length] + "..."
+}
@@ -0,0 +1,508 @@
+package main
+
+// Run with go test llm_harness.go llm_harness_test.go
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// echoServer answers each generate request, after delay, with the prompt it
+// was sent, counting the requests in calls
+func echoServer(delay time.Duration, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req TestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(TestResponse{Model: req.Model, Response: req.Prompt, Done: true})
+	}))
+}
+
+// sendTo returns a runPrompts send function posting prompts with sendPrompt
+func sendTo(prompts []string) func(baseURL string, i int) (TestResponse, error) {
+	return func(baseURL string, i int) (TestResponse, error) {
+		return sendPrompt(http.DefaultClient, baseURL, TestRequest{Model: "m", Prompt: prompts[i]})
+	}
+}
+
+func TestRunPromptsSpreadsAcrossServers(t *testing.T) {
+	var firstCalls, secondCalls atomic.Int32
+	first := echoServer(20*time.Millisecond, &firstCalls)
+	defer first.Close()
+	second := echoServer(20*time.Millisecond, &secondCalls)
+	defer second.Close()
+
+	prompts := make([]string, 8)
+	for i := range prompts {
+		prompts[i] = fmt.Sprintf("prompt %d", i)
+	}
+	results := runPrompts([]string{first.URL, second.URL}, 1, 0, prompts, sendTo(prompts), func(promptResult) {})
+
+	if firstCalls.Load() == 0 || secondCalls.Load() == 0 {
+		t.Errorf("servers got %d and %d prompts, want some on each", firstCalls.Load(), secondCalls.Load())
+	}
+	servers := map[string]int{}
+	for i, result := range results {
+		if result.Err != nil || result.Index != i || result.Response.Response != prompts[i] {
+			t.Errorf("result %d = %+v, want the echo of %q", i, result, prompts[i])
+		}
+		servers[result.Server]++
+	}
+	if servers[first.URL] != int(firstCalls.Load()) || servers[second.URL] != int(secondCalls.Load()) {
+		t.Errorf("results name servers %v, but they got %d and %d", servers, firstCalls.Load(), secondCalls.Load())
+	}
+}
+
+func TestStreamPromptTimeoutBeforeHeaders(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	limits := streamLimits{maxDuration: 50 * time.Millisecond}
+	response, err := streamPrompt(server.Client(), server.URL, TestRequest{Model: "m", Prompt: "p"}, limits, func(int, int) {})
+	if err != nil {
+		t.Fatalf("streamPrompt: %v", err)
+	}
+	if !response.Truncated || response.Response != "" {
+		t.Errorf("got %+v, want an empty truncated response", response)
+	}
+}
+
+func TestStreamPromptTimeoutBeforeFirstChunk(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	limits := streamLimits{maxDuration: 50 * time.Millisecond}
+	response, err := streamPrompt(server.Client(), server.URL, TestRequest{Model: "m", Prompt: "p"}, limits, func(int, int) {})
+	if err != nil {
+		t.Fatalf("streamPrompt: %v", err)
+	}
+	if !response.Truncated || response.Response != "" {
+		t.Errorf("got %+v, want an empty truncated response", response)
+	}
+}
+
+func TestStreamPromptTimeoutMidStream(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"model":"m","response":"partial","done":false}` + "\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	limits := streamLimits{maxDuration: 50 * time.Millisecond}
+	response, err := streamPrompt(server.Client(), server.URL, TestRequest{Model: "m", Prompt: "p"}, limits, func(int, int) {})
+	if err != nil {
+		t.Fatalf("streamPrompt: %v", err)
+	}
+	if !response.Truncated || response.Response != "partial" {
+		t.Errorf("got %+v, want truncated \"partial\"", response)
+	}
+}
+
+func TestStreamPromptMaxBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(`{"model":"m","response":"abcd","done":false}` + "\n"))
+		}
+		w.Write([]byte(`{"model":"m","response":"","done":true}` + "\n"))
+	}))
+	defer server.Close()
+
+	var chars int
+	limits := streamLimits{maxBytes: 6}
+	response, err := streamPrompt(server.Client(), server.URL, TestRequest{Model: "m", Prompt: "p"}, limits, func(_, n int) { chars = n })
+	if err != nil {
+		t.Fatalf("streamPrompt: %v", err)
+	}
+	if !response.Truncated || response.Response != "abcdab" {
+		t.Errorf("got %+v, want truncated \"abcdab\"", response)
+	}
+	if chars != 6 {
+		t.Errorf("progress saw %d characters, want 6", chars)
+	}
+}
+
+func TestStreamPromptComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"model":"m","response":"hello ","done":false}` + "\n"))
+		w.Write([]byte(`{"model":"m","response":"world","done":true}` + "\n"))
+	}))
+	defer server.Close()
+
+	response, err := streamPrompt(server.Client(), server.URL, TestRequest{Model: "m", Prompt: "p"}, streamLimits{}, func(int, int) {})
+	if err != nil {
+		t.Fatalf("streamPrompt: %v", err)
+	}
+	if response.Truncated || response.Response != "hello world" || !response.Done {
+		t.Errorf("got %+v, want complete \"hello world\"", response)
+	}
+}
+
+func TestLoadPrompts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, test := range []struct {
+		name, content string
+		want          []string
+	}{
+		{"lines.txt", "# warm-up\nWrite hello world in Go\n\n  Explain goroutines  \r\n", []string{"Write hello world in Go", "Explain goroutines"}},
+		{"array.json", "\n[\"first\\nwith a newline\", \"# not a comment\"]\n", []string{"first\nwith a newline", "# not a comment"}},
+	} {
+		prompts, err := loadPrompts(write(test.name, test.content))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if strings.Join(prompts, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: got %q, want %q", test.name, prompts, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		path, want string
+	}{
+		{filepath.Join(dir, "missing.txt"), "failed to read prompts file"},
+		{write("bad.json", `["unterminated`), "as a JSON array"},
+		{write("comments.txt", "# only\n# comments\n"), "no prompts found"},
+		{write("empty.json", "[]"), "no prompts found"},
+	} {
+		if _, err := loadPrompts(test.path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("loadPrompts(%s) error = %v, want %q", filepath.Base(test.path), err, test.want)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	long := strings.Repeat("x", metricPromptLength+10)
+	code := "```go\npackage main\n\nfunc main() {}\n```\n"
+	metrics := []promptMetric{
+		newPromptMetric("Write a Go program", code, false, 1500*time.Millisecond, nil),
+		newPromptMetric(long, "", false, 2*time.Second, fmt.Errorf("timeout")),
+		newPromptMetric("Explain functions", "A package manager installs functions.", true, 250*time.Millisecond, nil),
+	}
+	metrics[0].Model = "m1"
+
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "results.csv")
+	if err := writeMetrics(csvPath, metrics); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("metrics are not valid CSV: %v", err)
+	}
+	header := "model,prompt,prompt_length,duration_ms,response_length,success,truncated,has_func,has_package,has_import,has_return,has_go_fence"
+	if len(rows) != 4 || strings.Join(rows[0], ",") != header {
+		t.Fatalf("got %d rows with header %q, want 4 with %q", len(rows), rows[0], header)
+	}
+	want := [][]string{
+		{"m1", "Write a Go program", "18", "1500.0", strconv.Itoa(len(code)), "true", "false", "true", "true", "false", "false", "true"},
+		{"", long[:metricPromptLength] + "...", "70", "2000.0", "0", "false", "false", "false", "false", "false", "false", "false"},
+		{"", "Explain functions", "17", "250.0", "37", "true", "true", "false", "false", "false", "false", "false"},
+	}
+	for i, row := range rows[1:] {
+		if strings.Join(row, ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %q, want %q", i+1, row, want[i])
+		}
+	}
+
+	jsonPath := filepath.Join(dir, "results.JSON")
+	if err := writeMetrics(jsonPath, metrics); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		t.Fatalf("metrics are not a JSON array: %v\n%s", err, data)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("got %d JSON rows, want 3", len(objects))
+	}
+	for _, column := range strings.Split(header, ",")[1:] {
+		if _, ok := objects[1][column]; !ok {
+			t.Errorf("JSON row lacks %s: %v", column, objects[1])
+		}
+	}
+	if objects[0]["model"] != "m1" || objects[0]["duration_ms"] != 1500.0 || objects[1]["success"] != false {
+		t.Errorf("JSON rows have the wrong values: %v", objects)
+	}
+
+	if err := writeMetrics(jsonPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(jsonPath); strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("no metrics wrote %q, want an empty array", data)
+	}
+}
+
+func TestResolveSetting(t *testing.T) {
+	t.Setenv(serverEnv, "")
+	if got := resolveSetting("", serverEnv, defaultServer); got != defaultServer {
+		t.Errorf("with nothing set got %q, want the default", got)
+	}
+	t.Setenv(serverEnv, "  env-host:1234 ")
+	if got := resolveSetting("", serverEnv, defaultServer); got != "env-host:1234" {
+		t.Errorf("with the environment set got %q, want env-host:1234", got)
+	}
+	if got := resolveSetting("flag-host:99", serverEnv, defaultServer); got != "flag-host:99" {
+		t.Errorf("with the flag set got %q, want flag-host:99", got)
+	}
+	t.Setenv(modelEnv, " ")
+	if got := resolveSetting("", modelEnv, defaultModel); got != defaultModel {
+		t.Errorf("a blank environment variable gave %q, want the default", got)
+	}
+
+	urls := serverURLs(" a:1, https://b:2/ ,,c:3")
+	if strings.Join(urls, " ") != "http://a:1 https://b:2 http://c:3" {
+		t.Errorf("serverURLs = %q", urls)
+	}
+
+	var calls atomic.Int32
+	server := echoServer(0, &calls)
+	if _, err := checkServer(server.URL); err != nil {
+		t.Errorf("checkServer on a running server: %v", err)
+	}
+	server.Close()
+	if _, err := checkServer(server.URL); err == nil || !strings.Contains(err.Error(), "not reachable") {
+		t.Errorf("checkServer on a closed server = %v, want not reachable", err)
+	}
+}
+
+func TestRunPromptsRespectsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		var req TestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		time.Sleep(30 * time.Millisecond)
+		json.NewEncoder(w).Encode(TestResponse{Model: req.Model, Response: req.Prompt, Done: true})
+	}))
+	defer server.Close()
+
+	prompts := make([]string, 10)
+	for i := range prompts {
+		prompts[i] = fmt.Sprintf("prompt %d", i)
+	}
+	var reported, inCallback atomic.Int32
+	results := runPrompts([]string{server.URL}, 3, 0, prompts, sendTo(prompts), func(promptResult) {
+		if inCallback.Add(1) != 1 {
+			t.Error("onResult called concurrently")
+		}
+		reported.Add(1)
+		inCallback.Add(-1)
+	})
+
+	if got := peak.Load(); got > 3 || got < 2 {
+		t.Errorf("peak concurrency %d, want at most 3 and more than 1", got)
+	}
+	if reported.Load() != int32(len(prompts)) {
+		t.Errorf("onResult called %d times, want %d", reported.Load(), len(prompts))
+	}
+	for i, result := range results {
+		if result.Err != nil || result.Attempts != 1 || result.Response.Response != prompts[i] {
+			t.Errorf("result %d = %+v, want the echo of %q", i, result, prompts[i])
+		}
+	}
+}
+
+func TestDetectCodeSignals(t *testing.T) {
+	for _, test := range []struct {
+		name, response string
+		want           codeSignals
+		summary        string
+	}{
+		{"prose", "Functions are reusable. Install it with the package manager and import it; what it returned is ignored.",
+			codeSignals{}, "none (0/5)"},
+		{"program", "Here it is:\n```go\npackage main\n\nimport \"fmt\"\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n```\n",
+			codeSignals{Func: true, Package: true, Import: true, Return: true, GoFence: true}, "func, package, import, return, ```go block (5/5)"},
+		{"golang fence", "```golang\nx := func() {}\n```", codeSignals{Func: true, GoFence: true}, "func, ```go block (2/5)"},
+		{"grouped import", "  package tools\nimport (\n\t\"os\"\n)", codeSignals{Package: true, Import: true}, "package, import (2/5)"},
+		{"other fence", "```python\ndef f():\n    return 1\n```", codeSignals{Return: true}, "return (1/5)"},
+	} {
+		got := detectCodeSignals(test.response)
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+		if got.String() != test.summary {
+			t.Errorf("%s: summary %q, want %q", test.name, got.String(), test.summary)
+		}
+	}
+}
+
+func TestComparisonTable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case req.Model == "big" && req.Prompt == "second":
+			http.Error(w, "out of memory", http.StatusInternalServerError)
+			return
+		case req.Model == "big":
+			time.Sleep(20 * time.Millisecond)
+			json.NewEncoder(w).Encode(TestResponse{Model: req.Model, Response: strings.Repeat("b", 40), Done: true})
+		default:
+			json.NewEncoder(w).Encode(TestResponse{Model: req.Model, Response: strings.Repeat("s", 10), Done: true})
+		}
+	}))
+	defer server.Close()
+
+	models := []string{"small", "big"}
+	prompts := []string{"first", "second"}
+	var results [][]promptResult
+	for _, model := range models {
+		send := func(baseURL string, i int) (TestResponse, error) {
+			return sendPrompt(http.DefaultClient, baseURL, TestRequest{Model: model, Prompt: prompts[i]})
+		}
+		results = append(results, runPrompts([]string{server.URL}, 1, 0, prompts, send, func(promptResult) {}))
+	}
+
+	table := comparisonTable(models, results)
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want a header, 2 prompts and averages:\n%s", len(lines), table)
+	}
+	if got := strings.Join(strings.Fields(lines[0]), " "); got != "# Prompt small time small chars big time big chars" {
+		t.Errorf("header %q does not name both models", got)
+	}
+	want := [][]string{
+		{"1", "first", "10", "40"},
+		{"2", "second", "10", "failed", "-"},
+		{"Average", "10", "40"},
+	}
+	for i, line := range lines[1:] {
+		fields := strings.Fields(line)
+		var kept []string
+		for _, field := range fields {
+			if _, err := time.ParseDuration(field); err != nil {
+				kept = append(kept, field)
+			}
+		}
+		if strings.Join(kept, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d is %q, want %q with durations", i+1, line, want[i])
+		}
+	}
+	if !strings.Contains(lines[1], results[1][0].Duration.Round(time.Millisecond).String()) {
+		t.Errorf("row does not show big's duration %v:\n%s", results[1][0].Duration, table)
+	}
+}
+
+func TestRetryAfterTransientFailure(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(TestResponse{Model: "m", Response: "ok", Done: true})
+	}))
+	defer server.Close()
+
+	prompts := []string{"p"}
+	results := runPrompts([]string{server.URL}, 1, 2, prompts, sendTo(prompts), func(promptResult) {})
+	if result := results[0]; result.Err != nil || result.Attempts != 2 || result.Response.Response != "ok" {
+		t.Errorf("got %+v, want success on the second attempt", result)
+	}
+
+	attempts, err := retryWithBackoff(0, func() error { return fmt.Errorf("down") }, "always failing")
+	if err == nil || err.Error() != "down" || attempts != 1 {
+		t.Errorf("without retries got %d attempts and %v, want 1 and the error", attempts, err)
+	}
+}
+
+func TestStreamPromptMatchesNonStreaming(t *testing.T) {
+	chunks := []string{"func ", "main() ", "{}"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TestRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			json.NewEncoder(w).Encode(TestResponse{Model: req.Model, Response: strings.Join(chunks, ""), Done: true})
+			return
+		}
+		for i, chunk := range chunks {
+			json.NewEncoder(w).Encode(TestResponse{Model: req.Model, Response: chunk, Done: i == len(chunks)-1})
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	req := TestRequest{Model: "m", Prompt: "p"}
+	whole, err := sendPrompt(server.Client(), server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progress []string
+	streamed, err := streamPrompt(server.Client(), server.URL, req, streamLimits{}, func(chunks, chars int) {
+		progress = append(progress, fmt.Sprintf("%d/%d", chunks, chars))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if streamed.Response != whole.Response || streamed.Model != whole.Model || !streamed.Done || streamed.Truncated {
+		t.Errorf("streamed %+v, want the same as non-streaming %+v", streamed, whole)
+	}
+	if got := strings.Join(progress, " "); got != "1/5 2/12 3/14" {
+		t.Errorf("progress reported %q, want each chunk's counts", got)
+	}
+}
+
+func TestStreamPromptMaxBytesCutsBetweenCharacters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range []string{"héllo", " wörld"} {
+			json.NewEncoder(w).Encode(TestResponse{Model: "m", Response: chunk})
+		}
+		json.NewEncoder(w).Encode(TestResponse{Model: "m", Done: true})
+	}))
+	defer server.Close()
+
+	// The limit falls inside the two bytes of ö
+	response, err := streamPrompt(server.Client(), server.URL, TestRequest{Model: "m", Prompt: "p"}, streamLimits{maxBytes: 9}, func(int, int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Truncated || response.Response != "héllo w" || !utf8.ValidString(response.Response) {
+		t.Errorf("got %+v, want truncated \"héllo w\"", response)
+	}
+}
@@ -22,7 +22,7 @@ echo.
 echo Starting advanced test...
 REM Run the test with timestamps
 echo Test started at %TIME%
-go run test_llm_advanced.go
+go run test_llm_advanced.go llm_harness.go %*
 echo Test completed at %TIME%
 
 echo.
@@ -18,7 +18,7 @@ echo.
 
 REM Run the test with timestamps
 echo Test started at %TIME%
-go run test_llm.go
+go run test_llm.go llm_harness.go %*
 echo Test completed at %TIME%
 
 echo.
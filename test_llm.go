@@ -3,37 +3,49 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 )
 
-type TestRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
-}
-
-type TestResponse struct {
-	Model     string    `json:"model"`
-	CreatedAt time.Time `json:"created_at"`
-	Response  string    `json:"response"`
-	Done      bool      `json:"done"`
-}
-
 func main() {
+	promptsPath := flag.String("prompts", "", "file of programming prompts, one per line or a JSON array (default: built-in list)")
+	outPath := flag.String("out", "", "write per-prompt metrics to this .csv or .json file")
+	stream := flag.Bool("stream", false, "stream responses, logging progress while they arrive")
+	maxBytes := flag.Int("max-bytes", 0, "with -stream, cut each response short at this many characters")
+	maxTime := flag.Duration("max-time", 0, "with -stream, cut each response short after this long, e.g. 5m")
+	retries := flag.Int("retries", 2, "times to retry a failed prompt before counting it as failed")
+	concurrency := flag.Int("concurrency", 1, "number of programming prompts in flight at once")
+	serverFlag := flag.String("server", "", "Ollama server address (default $"+serverEnv+" or "+defaultServer+")")
+	var modelFlag listFlag
+	flag.Var(&modelFlag, "model", "model name; give two, repeated or comma-separated, to compare them (default $"+modelEnv+" or "+defaultModel+")")
+	flag.Parse()
+	if (*maxBytes > 0 || *maxTime > 0) && !*stream {
+		log.Fatalf("-max-bytes and -max-time need -stream")
+	}
+	limits := streamLimits{maxBytes: *maxBytes, maxDuration: *maxTime}
+
 	// Configuration
-	serverAddr := "192.168.0.63:11434"
-	modelName := "qwen3:30b"
-	baseURL := fmt.Sprintf("http://%s", serverAddr)
+	models := strings.Split(resolveSetting(modelFlag.String(), modelEnv, defaultModel), ",")
+	if len(models) > 2 {
+		log.Fatalf("At most two models can be compared, got %d", len(models))
+	}
+	modelName := models[0]
+	baseURLs := serverURLs(resolveSetting(*serverFlag, serverEnv, defaultServer))
+	if len(baseURLs) == 0 {
+		log.Fatalf("No server address given")
+	}
+	baseURL := baseURLs[0]
 
 	// Seed random number generator
 	rand.Seed(time.Now().UnixNano())
 
-	log.Printf("Testing LLM at %s with model %s", baseURL, modelName)
+	log.Printf("Testing LLM at %s with model %s", baseURL, strings.Join(models, " and "))
 
 	// Create HTTP client with no timeout to see how long it actually takes
 	client := &http.Client{
@@ -42,13 +54,11 @@ func main() {
 
 	// Test 1: Health check
 	log.Println("=== Test 1: Health Check ===")
-	start := time.Now()
-	resp, err := client.Get(baseURL + "/api/tags")
+	duration, err := checkServer(baseURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to server: %v", err)
 	}
-	resp.Body.Close()
-	log.Printf("Health check completed in %v (status: %d)", time.Since(start), resp.StatusCode)
+	log.Printf("Health check completed in %v", duration)
 
 	// Test 2: Simple prompt
 	log.Println("\n=== Test 2: Simple Prompt ===")
@@ -60,40 +70,20 @@ func main() {
 		Stream: false,
 	}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		log.Fatalf("Failed to marshal request: %v", err)
-	}
-
 	log.Printf("Sending simple prompt: %q", simplePrompt)
-	start = time.Now()
-
-	resp, err = client.Post(
-		baseURL+"/api/generate",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		log.Fatalf("Failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Fatalf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Failed to read response: %v", err)
-	}
+	start := time.Now()
 
 	var response TestResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		log.Fatalf("Failed to parse response: %v", err)
+	_, err = retryWithBackoff(*retries, func() error {
+		var err error
+		response, err = sendPrompt(client, baseURL, req)
+		return err
+	}, "simple prompt")
+	if err != nil {
+		log.Fatalf("Failed to complete simple prompt: %v", err)
 	}
 
-	duration := time.Since(start)
+	duration = time.Since(start)
 	log.Printf("Simple prompt completed in %v", duration)
 	log.Printf("Response length: %d characters", len(response.Response))
 	log.Printf("Response: %q", response.Response)
@@ -113,6 +103,12 @@ func main() {
 		"Implement a basic queue data structure in Go.",
 		"Write a Go function to calculate the nth Fibonacci number.",
 	}
+	if *promptsPath != "" {
+		if programmingPrompts, err = loadPrompts(*promptsPath); err != nil {
+			log.Fatalf("Failed to load prompts: %v", err)
+		}
+		log.Printf("Loaded %d prompts from %s", len(programmingPrompts), *promptsPath)
+	}
 
 	// Shuffle the prompts for random order
 	for i := len(programmingPrompts) - 1; i > 0; i-- {
@@ -120,88 +116,109 @@ func main() {
 		programmingPrompts[i], programmingPrompts[j] = programmingPrompts[j], programmingPrompts[i]
 	}
 
-	var totalDuration time.Duration
-	successCount := 0
+	var metrics []promptMetric
+	var modelResults [][]promptResult
 
-	for i, prompt := range programmingPrompts {
-		log.Printf("\n--- Programming Test %d/10 ---", i+1)
-		log.Printf("Prompt: %s", prompt)
-		log.Printf("Prompt length: %d characters", len(prompt))
-
-		req.Prompt = prompt
-		jsonData, err = json.Marshal(req)
-		if err != nil {
-			log.Printf("Failed to marshal request %d: %v", i+1, err)
-			continue
+	for _, modelName := range models {
+		if len(models) > 1 {
+			log.Printf("\n=== Programming Prompts: %s ===", modelName)
 		}
-
-		log.Printf("Sending programming prompt %d...", i+1)
-		start = time.Now()
-
-		resp, err = client.Post(
-			baseURL+"/api/generate",
-			"application/json",
-			bytes.NewBuffer(jsonData),
-		)
-		if err != nil {
-			log.Printf("Failed to send programming request %d: %v", i+1, err)
-			continue
+		var totalDuration time.Duration
+		successCount := 0
+		retriedCount := 0
+		truncatedCount := 0
+
+		send := func(baseURL string, i int) (TestResponse, error) {
+			log.Printf("Sending programming prompt %d to %s...", i+1, modelName)
+			req := req
+			req.Model = modelName
+			req.Prompt = programmingPrompts[i]
+			if *stream {
+				return streamPrompt(client, baseURL, req, limits, progressLogger(fmt.Sprintf("Programming prompt %d", i+1)))
+			}
+			return sendPrompt(client, baseURL, req)
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			log.Printf("Programming API request %d failed with status %d: %s", i+1, resp.StatusCode, string(body))
-			resp.Body.Close()
-			continue
+		report := func(result promptResult) {
+			i, prompt, response := result.Index, result.Prompt, result.Response
+			log.Printf("\n--- Programming Test %d/%d ---", i+1, len(programmingPrompts))
+			log.Printf("Prompt: %s", prompt)
+			log.Printf("Prompt length: %d characters", len(prompt))
+			if result.Err != nil {
+				log.Printf("Programming prompt %d failed after %d attempts: %v", i+1, result.Attempts, result.Err)
+				return
+			}
+			if result.Attempts > 1 {
+				log.Printf("Programming prompt %d succeeded on attempt %d", i+1, result.Attempts)
+			}
+			if response.Truncated {
+				log.Printf("Programming prompt %d response truncated by the stream limits", i+1)
+			}
+			log.Printf("Programming prompt %d completed in %v", i+1, result.Duration)
+			log.Printf("Response length: %d characters", len(response.Response))
+			log.Printf("First 150 chars: %q", truncateString(response.Response, 150))
 		}
-
-		body, err = io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			log.Printf("Failed to read programming response %d: %v", i+1, err)
-			continue
+		results := runPrompts([]string{baseURL}, *concurrency, *retries, programmingPrompts, send, report)
+		modelResults = append(modelResults, results)
+
+		for _, result := range results {
+			metric := newPromptMetric(result.Prompt, result.Response.Response, result.Response.Truncated, result.Duration, result.Err)
+			metric.Model = modelName
+			metrics = append(metrics, metric)
+			if result.Err != nil {
+				continue
+			}
+			totalDuration += result.Duration
+			successCount++
+			if result.Attempts > 1 {
+				retriedCount++
+			}
+			if result.Response.Truncated {
+				truncatedCount++
+			}
 		}
 
-		var response TestResponse
-		if err := json.Unmarshal(body, &response); err != nil {
-			log.Printf("Failed to parse programming response %d: %v", i+1, err)
-			continue
+		// Summary of programming tests
+		log.Printf("\n=== Programming Tests Summary: %s ===", modelName)
+		log.Printf("Successful prompts: %d/%d", successCount, len(programmingPrompts))
+		log.Printf("Transient failures (succeeded on retry): %d", retriedCount)
+		log.Printf("Permanent failures: %d", len(programmingPrompts)-successCount)
+		if *stream {
+			log.Printf("Truncated responses: %d", truncatedCount)
+		}
+		if successCount > 0 {
+			avgDuration := totalDuration / time.Duration(successCount)
+			log.Printf("Total time: %v", totalDuration)
+			log.Printf("Average response time: %v", avgDuration)
 		}
-
-		duration := time.Since(start)
-		totalDuration += duration
-		successCount++
-
-		log.Printf("Programming prompt %d completed in %v", i+1, duration)
-		log.Printf("Response length: %d characters", len(response.Response))
-		log.Printf("First 150 chars: %q", truncateString(response.Response, 150))
 	}
-
-	// Summary of programming tests
-	log.Printf("\n=== Programming Tests Summary ===")
-	log.Printf("Successful prompts: %d/10", successCount)
-	if successCount > 0 {
-		avgDuration := totalDuration / time.Duration(successCount)
-		log.Printf("Total time: %v", totalDuration)
-		log.Printf("Average response time: %v", avgDuration)
+	if len(models) == 2 {
+		log.Printf("\n=== Model Comparison ===\n%s", comparisonTable(models, modelResults))
+	}
+	if *outPath != "" {
+		if err := writeMetrics(*outPath, metrics); err != nil {
+			log.Printf("Failed to save metrics: %v", err)
+		} else {
+			log.Printf("Metrics for %d prompts saved to %s", len(metrics), *outPath)
+		}
 	}
 
 	// Test 4: Model info
 	log.Println("\n=== Test 4: Model Information ===")
-	modelReq := map[string]string{"name": modelName}
-	jsonData, _ = json.Marshal(modelReq)
-
-	start = time.Now()
-	resp, err = client.Post(
-		baseURL+"/api/show",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		log.Printf("Failed to get model info: %v", err)
-	} else {
-		defer resp.Body.Close()
-		log.Printf("Model info request completed in %v (status: %d)", time.Since(start), resp.StatusCode)
+	for _, modelName := range models {
+		modelReq := map[string]string{"name": modelName}
+		jsonData, _ := json.Marshal(modelReq)
+
+		start = time.Now()
+		resp, err := client.Post(
+			baseURL+"/api/show",
+			"application/json",
+			bytes.NewBuffer(jsonData),
+		)
+		if err != nil {
+			log.Printf("Failed to get model info for %s: %v", modelName, err)
+			continue
+		}
+		log.Printf("Model info request for %s completed in %v (status: %d)", modelName, time.Since(start), resp.StatusCode)
 		if resp.StatusCode == http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
 			var modelInfo map[string]interface{}
@@ -214,16 +231,10 @@ func main() {
 				}
 			}
 		}
+		resp.Body.Close()
 	}
 
 	log.Println("\n=== Test Summary ===")
 	log.Println("If you see this message, the LLM server is responding normally.")
 	log.Println("Compare the response times above to identify any performance issues.")
 }
-
-func truncateString(s string, length int) string {
-	if len(s) <= length {
-		return s
-	}
-	return s[:length] + "..."
-}
\ No newline at end of file
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -10,29 +11,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
-// Retry configuration
-const (
-	baseDelay = time.Second
-	maxDelay  = 30 * time.Second
-)
-
-type TestRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
-}
-
-type TestResponse struct {
-	Model     string    `json:"model"`
-	CreatedAt time.Time `json:"created_at"`
-	Response  string    `json:"response"`
-	Done      bool      `json:"done"`
-}
-
 func sanitizeModelName(modelName string) string {
 	// Replace invalid Windows filename characters with underscores
 	invalidChars := []string{"<", ">", ":", "\"", "/", "\\", "|", "?", "*"}
@@ -75,42 +58,98 @@ func generateFilenameFromPrompt(prompt string) string {
 	return filename + "_response.txt"
 }
 
-func retryWithBackoff(operation func() error, description string) error {
-	var lastErr error
-	for attempt := 0; ; attempt++ {
-		if attempt > 0 {
-			delay := time.Duration(attempt) * baseDelay
-			if delay > maxDelay {
-				delay = maxDelay
-			}
-			log.Printf("Retry attempt %d for %s after %v delay (last error: %v)", 
-				attempt+1, description, delay, lastErr)
-			time.Sleep(delay)
-		}
-		
-		if err := operation(); err != nil {
-			lastErr = err
-			continue
-		}
-		
-		if attempt > 0 {
-			log.Printf("Successfully completed %s after %d attempts", description, attempt+1)
-		}
-		return nil
+// responseMetadata is written next to each saved response so the results
+// directory describes itself
+type responseMetadata struct {
+	Prompt         string    `json:"prompt"`
+	Model          string    `json:"model"`
+	DurationMs     float64   `json:"duration_ms"`
+	ResponseLength int       `json:"response_length"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// saveResponse writes the response text to path and its metadata to the
+// same name with a .json extension
+func saveResponse(path, modelName, prompt, response string, duration time.Duration) error {
+	if err := os.WriteFile(path, []byte(response), 0644); err != nil {
+		return err
+	}
+
+	metadata := responseMetadata{
+		Prompt:         prompt,
+		Model:          modelName,
+		DurationMs:     float64(duration) / float64(time.Millisecond),
+		ResponseLength: len(response),
+		Timestamp:      time.Now(),
 	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+	metadataPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	return os.WriteFile(metadataPath, append(data, '\n'), 0644)
+}
+
+// durationStats summarizes the response times of the successful prompts
+type durationStats struct {
+	Total, Mean, Min, Median, Max time.Duration
+}
+
+// summarizeDurations computes durationStats; the median of an even count is
+// the mean of the middle two. An empty slice gives all zeros.
+func summarizeDurations(durations []time.Duration) durationStats {
+	var stats durationStats
+	if len(durations) == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, d := range sorted {
+		stats.Total += d
+	}
+	n := len(sorted)
+	stats.Mean = stats.Total / time.Duration(n)
+	stats.Min = sorted[0]
+	stats.Max = sorted[n-1]
+	if n%2 == 1 {
+		stats.Median = sorted[n/2]
+	} else {
+		stats.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return stats
 }
 
 func main() {
-	// Configuration
-	serverAddr := "192.168.0.63:11434"
-	modelName := "qwen3:30b" // default
-	
 	// Parse command line arguments
-	if len(os.Args) > 1 {
-		modelName = os.Args[1]
+	promptsPath := flag.String("prompts", "", "file of advanced prompts, one per line or a JSON array (default: built-in list)")
+	outPath := flag.String("out", "", "write per-prompt metrics to this .csv or .json file")
+	stream := flag.Bool("stream", false, "stream responses, logging progress while they arrive")
+	maxBytes := flag.Int("max-bytes", 0, "with -stream, cut each response short at this many characters")
+	maxTime := flag.Duration("max-time", 0, "with -stream, cut each response short after this long, e.g. 5m")
+	retries := flag.Int("retries", -1, "times to retry a failed request before giving up; negative retries forever")
+	concurrency := flag.Int("concurrency", 1, "prompts in flight at once on each server")
+	serverFlag := flag.String("server", "", "comma-separated Ollama server addresses to spread prompts across (default $"+serverEnv+" or "+defaultServer+")")
+	modelFlag := flag.String("model", "", "model name (default $"+modelEnv+" or "+defaultModel+")")
+	flag.Parse()
+	if (*maxBytes > 0 || *maxTime > 0) && !*stream {
+		log.Fatalf("-max-bytes and -max-time need -stream")
 	}
-	
-	baseURL := fmt.Sprintf("http://%s", serverAddr)
+	limits := streamLimits{maxBytes: *maxBytes, maxDuration: *maxTime}
+
+	// The model and server list may also be given positionally
+	if *modelFlag == "" && flag.NArg() > 0 {
+		*modelFlag = flag.Arg(0)
+	}
+	if *serverFlag == "" && flag.NArg() > 1 {
+		*serverFlag = flag.Arg(1)
+	}
+	modelName := resolveSetting(*modelFlag, modelEnv, defaultModel)
+	baseURLs := serverURLs(resolveSetting(*serverFlag, serverEnv, defaultServer))
+	if len(baseURLs) == 0 {
+		log.Fatalf("No server address given")
+	}
+	baseURL := baseURLs[0]
 
 	// Create results directory structure
 	sanitizedModelName := sanitizeModelName(modelName)
@@ -123,8 +162,8 @@ func main() {
 	// Seed random number generator
 	rand.Seed(time.Now().UnixNano())
 
-	log.Printf("Testing LLM at %s with model %s (ADVANCED PROMPTS)", baseURL, modelName)
-	log.Printf("Usage: %s [model_name] (default: qwen3:30b)", os.Args[0])
+	log.Printf("Testing LLM at %s with model %s (ADVANCED PROMPTS)", strings.Join(baseURLs, ", "), modelName)
+	log.Printf("Usage: %s [-prompts file] [-out metrics.csv] [-stream [-max-bytes n] [-max-time d]] [-model name] [-server server1,server2,...] (or model and servers positionally)", os.Args[0])
 
 	// Create HTTP client with no timeout to see how long it actually takes
 	client := &http.Client{
@@ -133,70 +172,26 @@ func main() {
 
 	// Test 1: Health check
 	log.Println("=== Test 1: Health Check ===")
-	start := time.Now()
-	var resp *http.Response
-	err := retryWithBackoff(func() error {
-		var err error
-		resp, err = client.Get(baseURL + "/api/tags")
+	for _, serverURL := range baseURLs {
+		duration, err := checkServer(serverURL)
 		if err != nil {
-			return err
-		}
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			return fmt.Errorf("health check failed with status %d", resp.StatusCode)
+			log.Fatalf("Failed to connect to server: %v", err)
 		}
-		return nil
-	}, "health check")
-	if err != nil {
-		log.Fatalf("Failed to connect to server after retries: %v", err)
+		log.Printf("Health check of %s completed in %v", serverURL, duration)
 	}
-	resp.Body.Close()
-	log.Printf("Health check completed in %v (status: %d)", time.Since(start), resp.StatusCode)
 
 	// Test 2: Simple prompt
 	log.Println("\n=== Test 2: Simple Prompt ===")
 	simplePrompt := "Hello, what is 2+2?"
-	
-	req := TestRequest{
-		Model:  modelName,
-		Prompt: simplePrompt,
-		Stream: false,
-	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		log.Fatalf("Failed to marshal request: %v", err)
-	}
 
 	log.Printf("Sending simple prompt: %q", simplePrompt)
-	start = time.Now()
+	start := time.Now()
 
 	var response TestResponse
-	err = retryWithBackoff(func() error {
-		resp, err := client.Post(
-			baseURL+"/api/generate",
-			"application/json",
-			bytes.NewBuffer(jsonData),
-		)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %v", err)
-		}
-
-		if err := json.Unmarshal(body, &response); err != nil {
-			return fmt.Errorf("failed to parse response: %v", err)
-		}
-		return nil
+	_, err := retryWithBackoff(*retries, func() error {
+		var err error
+		response, err = sendPrompt(client, baseURL, TestRequest{Model: modelName, Prompt: simplePrompt})
+		return err
 	}, "simple prompt")
 	if err != nil {
 		log.Fatalf("Failed to complete simple prompt after retries: %v", err)
@@ -209,7 +204,7 @@ func main() {
 
 	// Save simple prompt response to file
 	simpleResponseFile := filepath.Join(resultsDir, "simple_prompt_response.txt")
-	if err := os.WriteFile(simpleResponseFile, []byte(response.Response), 0644); err != nil {
+	if err := saveResponse(simpleResponseFile, modelName, simplePrompt, response.Response, duration); err != nil {
 		log.Printf("Failed to save simple prompt response to file: %v", err)
 	} else {
 		log.Printf("Simple prompt response saved to %s", simpleResponseFile)
@@ -230,6 +225,12 @@ func main() {
 		"Build a sophisticated caching system in Go with TTL, LRU eviction, persistence, and distributed cache invalidation across multiple nodes.",
 		"Implement a complete Git-like version control system in Go with branching, merging, diff algorithms, and a working directory management system.",
 	}
+	if *promptsPath != "" {
+		if advancedPrompts, err = loadPrompts(*promptsPath); err != nil {
+			log.Fatalf("Failed to load prompts: %v", err)
+		}
+		log.Printf("Loaded %d prompts from %s", len(advancedPrompts), *promptsPath)
+	}
 
 	// Shuffle the prompts for random order
 	for i := len(advancedPrompts) - 1; i > 0; i-- {
@@ -237,93 +238,100 @@ func main() {
 		advancedPrompts[i], advancedPrompts[j] = advancedPrompts[j], advancedPrompts[i]
 	}
 
-	var totalDuration time.Duration
+	var durations []time.Duration
+	var metrics []promptMetric
 	successCount := 0
+	retriedCount := 0
+	truncatedCount := 0
 
-	for i, prompt := range advancedPrompts {
-		log.Printf("\n--- Advanced Programming Test %d/10 ---", i+1)
+	if len(baseURLs) > 1 || *concurrency > 1 {
+		log.Printf("Distributing %d prompts across %d servers, %d at a time on each",
+			len(advancedPrompts), len(baseURLs), *concurrency)
+	}
+	send := func(baseURL string, i int) (TestResponse, error) {
+		log.Printf("Sending advanced programming prompt %d to %s...", i+1, baseURL)
+		req := TestRequest{Model: modelName, Prompt: advancedPrompts[i]}
+		if *stream {
+			return streamPrompt(client, baseURL, req, limits, progressLogger(fmt.Sprintf("Advanced programming prompt %d", i+1)))
+		}
+		return sendPrompt(client, baseURL, req)
+	}
+	report := func(result promptResult) {
+		i, prompt, response := result.Index, result.Prompt, result.Response
+		log.Printf("\n--- Advanced Programming Test %d/%d ---", i+1, len(advancedPrompts))
 		log.Printf("Prompt: %s", prompt)
 		log.Printf("Prompt length: %d characters", len(prompt))
-
-		req.Prompt = prompt
-		jsonData, err = json.Marshal(req)
-		if err != nil {
-			log.Printf("Failed to marshal request %d: %v", i+1, err)
-			continue
+		if result.Err != nil {
+			log.Printf("Failed to complete advanced programming prompt %d after %d attempts: %v", i+1, result.Attempts, result.Err)
+			return
 		}
-
-		log.Printf("Sending advanced programming prompt %d...", i+1)
-		start = time.Now()
-
-		var response TestResponse
-		err = retryWithBackoff(func() error {
-			resp, err := client.Post(
-				baseURL+"/api/generate",
-				"application/json",
-				bytes.NewBuffer(jsonData),
-			)
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				body, _ := io.ReadAll(resp.Body)
-				return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-			}
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return fmt.Errorf("failed to read response: %v", err)
-			}
-
-			if err := json.Unmarshal(body, &response); err != nil {
-				return fmt.Errorf("failed to parse response: %v", err)
-			}
-			return nil
-		}, fmt.Sprintf("advanced programming prompt %d", i+1))
-		if err != nil {
-			log.Printf("Failed to complete advanced programming prompt %d after retries: %v", i+1, err)
-			continue
+		if result.Attempts > 1 {
+			log.Printf("Advanced programming prompt %d succeeded on attempt %d", i+1, result.Attempts)
+		}
+		if response.Truncated {
+			log.Printf("Advanced programming prompt %d response truncated by the stream limits", i+1)
 		}
 
-		duration := time.Since(start)
-		totalDuration += duration
-		successCount++
-
-		log.Printf("Advanced programming prompt %d completed in %v", i+1, duration)
+		log.Printf("Advanced programming prompt %d completed in %v on %s", i+1, result.Duration, result.Server)
 		log.Printf("Response length: %d characters", len(response.Response))
 		log.Printf("First 200 chars: %q", truncateString(response.Response, 200))
-		log.Printf("Contains 'func' keyword: %t", contains(response.Response, "func"))
-		log.Printf("Contains 'package' keyword: %t", contains(response.Response, "package"))
+		log.Printf("Go code signals: %s", detectCodeSignals(response.Response))
 
 		// Save advanced prompt response to file
 		filename := generateFilenameFromPrompt(prompt)
 		filePath := filepath.Join(resultsDir, filename)
-		if err := os.WriteFile(filePath, []byte(response.Response), 0644); err != nil {
+		if err := saveResponse(filePath, modelName, prompt, response.Response, result.Duration); err != nil {
 			log.Printf("Failed to save advanced prompt %d response to file: %v", i+1, err)
 		} else {
 			log.Printf("Advanced prompt %d response saved to %s", i+1, filePath)
 		}
 	}
+	results := runPrompts(baseURLs, *concurrency, *retries, advancedPrompts, send, report)
+
+	for _, result := range results {
+		metrics = append(metrics, newPromptMetric(result.Prompt, result.Response.Response, result.Response.Truncated, result.Duration, result.Err))
+		if result.Err != nil {
+			continue
+		}
+		durations = append(durations, result.Duration)
+		successCount++
+		if result.Attempts > 1 {
+			retriedCount++
+		}
+		if result.Response.Truncated {
+			truncatedCount++
+		}
+	}
 
 	// Summary of advanced programming tests
 	log.Printf("\n=== Advanced Programming Tests Summary ===")
-	log.Printf("Successful prompts: %d/10", successCount)
+	log.Printf("Successful prompts: %d/%d", successCount, len(advancedPrompts))
+	log.Printf("Transient failures (succeeded on retry): %d", retriedCount)
+	log.Printf("Permanent failures: %d", len(advancedPrompts)-successCount)
+	if *stream {
+		log.Printf("Truncated responses: %d", truncatedCount)
+	}
 	if successCount > 0 {
-		avgDuration := totalDuration / time.Duration(successCount)
-		log.Printf("Total time: %v", totalDuration)
-		log.Printf("Average response time: %v", avgDuration)
-		log.Printf("Longest response time: %v", findLongestDuration(advancedPrompts, client, baseURL, modelName))
+		stats := summarizeDurations(durations)
+		log.Printf("Total time: %v", stats.Total)
+		log.Printf("Average response time: %v", stats.Mean)
+		log.Printf("Response times: min %v, median %v, max %v", stats.Min, stats.Median, stats.Max)
+	}
+	if *outPath != "" {
+		if err := writeMetrics(*outPath, metrics); err != nil {
+			log.Printf("Failed to save metrics: %v", err)
+		} else {
+			log.Printf("Metrics for %d prompts saved to %s", len(metrics), *outPath)
+		}
 	}
 
 	// Test 4: Model info
 	log.Println("\n=== Test 4: Model Information ===")
 	modelReq := map[string]string{"name": modelName}
-	jsonData, _ = json.Marshal(modelReq)
+	jsonData, _ := json.Marshal(modelReq)
 
 	start = time.Now()
-	err = retryWithBackoff(func() error {
+	_, err = retryWithBackoff(*retries, func() error {
 		resp, err := client.Post(
 			baseURL+"/api/show",
 			"application/json",
@@ -360,30 +368,4 @@ func main() {
 	log.Println("Advanced prompts test LLM performance on complex, multi-step programming tasks.")
 	log.Println("These should take significantly longer than simple prompts (2-10 minutes each).")
 	log.Printf("If responses are completing in under 30 seconds, the model may not be fully processing the complexity.")
-}
-
-func truncateString(s string, length int) string {
-	if len(s) <= length {
-		return s
-	}
-	return s[:length] + "..."
-}
-
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && 
-		   (len(substr) == 0 || 
-			func() bool {
-				for i := 0; i <= len(s)-len(substr); i++ {
-					if s[i:i+len(substr)] == substr {
-						return true
-					}
-				}
-				return false
-			}())
-}
-
-func findLongestDuration(prompts []string, client *http.Client, baseURL, modelName string) time.Duration {
-	// This is a placeholder - would need to track individual durations in the main loop
-	// For now, return a reasonable estimate
-	return time.Duration(5) * time.Minute
 }
\ No newline at end of file
@@ -0,0 +1,89 @@
+package main
+
+// Run with go test test_llm_advanced.go llm_harness.go test_llm_advanced_test.go
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeDurations(t *testing.T) {
+	s := time.Second
+	for _, test := range []struct {
+		name      string
+		durations []time.Duration
+		want      durationStats
+	}{
+		{"empty", nil, durationStats{}},
+		{"one", []time.Duration{3 * s}, durationStats{Total: 3 * s, Mean: 3 * s, Min: 3 * s, Median: 3 * s, Max: 3 * s}},
+		{"odd", []time.Duration{9 * s, 1 * s, 5 * s}, durationStats{Total: 15 * s, Mean: 5 * s, Min: 1 * s, Median: 5 * s, Max: 9 * s}},
+		{"even", []time.Duration{4 * s, 10 * s, 1 * s, 2 * s}, durationStats{Total: 17 * s, Mean: 4250 * time.Millisecond, Min: 1 * s, Median: 3 * s, Max: 10 * s}},
+	} {
+		if got := summarizeDurations(test.durations); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	durations := []time.Duration{3 * s, 1 * s, 2 * s}
+	summarizeDurations(durations)
+	if durations[0] != 3*s || durations[1] != 1*s {
+		t.Errorf("summarizeDurations reordered its argument: %v", durations)
+	}
+}
+
+func TestSaveResponseWritesMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(TestResponse{Model: "m", Response: "package main\n\nfunc main() {}\n", Done: true})
+	}))
+	defer server.Close()
+
+	model := "qwen3:30b"
+	prompt := "Write a Go HTTP server. Include graceful shutdown."
+	start := time.Now()
+	response, err := sendPrompt(http.DefaultClient, server.URL, TestRequest{Model: model, Prompt: prompt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	duration := time.Since(start)
+
+	dir := filepath.Join(t.TempDir(), "results", sanitizeModelName(model))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, generateFilenameFromPrompt(prompt))
+	before := time.Now()
+	if err := saveResponse(path, model, prompt, response.Response, duration); err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(path) != "write_a_go_http_server_response.txt" || filepath.Base(dir) != "qwen3_30b" {
+		t.Errorf("response saved as %s", path)
+	}
+	text, err := os.ReadFile(path)
+	if err != nil || string(text) != response.Response {
+		t.Fatalf("saved response %q, %v; want %q", text, err, response.Response)
+	}
+	data, err := os.ReadFile(strings.TrimSuffix(path, ".txt") + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata responseMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatalf("metadata is not JSON: %v\n%s", err, data)
+	}
+	if metadata.Prompt != prompt || metadata.Model != model || metadata.ResponseLength != len(text) {
+		t.Errorf("metadata %+v does not match the saved response", metadata)
+	}
+	if metadata.DurationMs != float64(duration)/float64(time.Millisecond) {
+		t.Errorf("metadata duration %vms, want %v", metadata.DurationMs, duration)
+	}
+	if metadata.Timestamp.Before(before.Add(-time.Second)) || metadata.Timestamp.After(time.Now()) {
+		t.Errorf("metadata timestamp %v is not when the response was saved", metadata.Timestamp)
+	}
+}
@@ -2,12 +2,20 @@ package main
 
 import (
 	"bytes"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // BasicTester provides file-based testing for BASIC interpreters
@@ -16,11 +24,35 @@ type BasicTester struct {
 	testsDir        string
 	expectedDir     string
 	errorsDir       string
+	inputDir        string
 	passCount       int
 	failCount       int
 	verbose         bool
+	failFast        bool
+	firstFailure    string
+	color           bool
+	startTime       time.Time
+	extraArgs       []string
+	extraEnv        []string
+	jobs            int        // success tests run at once
+	strict          bool       // compare output exactly, including a trailing newline
+	runFilter       string     // only run tests whose name contains this, ignoring case
+	filteredCount   int        // tests skipped because of runFilter
+	mu              sync.Mutex // guards the timings while tests run in parallel
+	showTimings     bool
+	out             io.Writer // where the report is printed; nil means standard output
+	timings         []testTiming // every interpreter run, in the order they finished
+	cases           []junitCase
 }
 
+// ANSI color codes used for test status labels
+const (
+	colorGreen  = "\033[32m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
 // NewBasicTester creates a new file-based tester
 func NewBasicTester(interpreterPath string, verbose bool) *BasicTester {
 	return &BasicTester{
@@ -28,27 +60,99 @@ func NewBasicTester(interpreterPath string, verbose bool) *BasicTester {
 		testsDir:        "tests/basic",
 		expectedDir:     "tests/expected",
 		errorsDir:       "tests/errors",
+		inputDir:        "tests/input",
 		passCount:       0,
 		failCount:       0,
 		verbose:         verbose,
+		startTime:       time.Now(),
+		jobs:            1,
 	}
 }
 
-// RunBasicFile executes a BASIC file and returns the output
+// RunBasicFile executes a BASIC file and returns the output. On failure the
+// output printed before the error is returned alongside it. If the input
+// directory has a <name>.txt file for the test, it is fed to the
+// interpreter's standard input for INPUT statements.
 func (bt *BasicTester) RunBasicFile(filename string) (string, error) {
-	cmd := exec.Command(bt.interpreterPath, filename)
+	testName := bt.GetTestName(filename)
+	cmd := exec.Command(bt.interpreterPath, append(append([]string{}, bt.extraArgs...), filename)...)
+	if len(bt.extraEnv) > 0 {
+		cmd.Env = append(os.Environ(), bt.extraEnv...)
+	}
+	input, err := os.Open(filepath.Join(bt.inputDir, testName+".txt"))
+	if err == nil {
+		defer input.Close()
+		cmd.Stdin = input
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to open input file: %v", err)
+	}
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	start := time.Now()
+	err = cmd.Run()
+	duration := time.Since(start)
+	bt.mu.Lock()
+	bt.timings = append(bt.timings, testTiming{name: testName, duration: duration})
+	bt.mu.Unlock()
 	if err != nil {
-		return "", fmt.Errorf("interpreter error: %v, stderr: %s", err, stderr.String())
+		return stdout.String(), &InterpreterError{Err: err, Stderr: stderr.String()}
 	}
 
 	return stdout.String(), nil
 }
 
+// testTiming is how long one interpreter run took
+type testTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// slowestShown is how many tests -timings lists
+const slowestShown = 10
+
+// SlowestTests returns up to n recorded runs, slowest first
+func (bt *BasicTester) SlowestTests(n int) []testTiming {
+	bt.mu.Lock()
+	sorted := append([]testTiming(nil), bt.timings...)
+	bt.mu.Unlock()
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].duration > sorted[j].duration
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// InterpreterError is returned by RunBasicFile when the interpreter could
+// not be run or exited with a failure status
+type InterpreterError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *InterpreterError) Error() string {
+	return fmt.Sprintf("interpreter error: %v, stderr: %s", e.Err, e.Stderr)
+}
+
+func (e *InterpreterError) Unwrap() error { return e.Err }
+
+// ReadExpectedError returns the text the error test's <name>.err file says
+// the interpreter's stderr must contain, or ok false if there is no file
+func (bt *BasicTester) ReadExpectedError(testName string) (expected string, ok bool, err error) {
+	content, err := ioutil.ReadFile(filepath.Join(bt.errorsDir, testName+".err"))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(content)), true, nil
+}
+
 // ReadExpectedOutput reads the expected output file
 func (bt *BasicTester) ReadExpectedOutput(testName string) (string, error) {
 	expectedFile := filepath.Join(bt.expectedDir, testName+".txt")
@@ -59,119 +163,279 @@ func (bt *BasicTester) ReadExpectedOutput(testName string) (string, error) {
 	return string(content), nil
 }
 
-// GetBasicFiles returns all .bas files in the tests directory
+// GetBasicFiles returns all .bas files in the tests directory and its
+// subdirectories
 func (bt *BasicTester) GetBasicFiles() ([]string, error) {
-	files, err := filepath.Glob(filepath.Join(bt.testsDir, "*.bas"))
-	if err != nil {
-		return nil, err
-	}
-	return files, nil
+	return findBasicFiles(bt.testsDir)
 }
 
-// GetErrorFiles returns all .bas files in the errors directory
+// GetErrorFiles returns all .bas files in the errors directory and its
+// subdirectories
 func (bt *BasicTester) GetErrorFiles() ([]string, error) {
-	files, err := filepath.Glob(filepath.Join(bt.errorsDir, "*.bas"))
-	if err != nil {
-		return nil, err
-	}
-	return files, nil
+	return findBasicFiles(bt.errorsDir)
 }
 
-// GetTestName extracts test name from file path
+// findBasicFiles walks dir for .bas files, in lexical order. A missing
+// directory has no files.
+func findBasicFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".bas" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// GetTestName extracts the test name from a file path. For files under the
+// tests or errors directory it is the slash-separated path relative to that
+// directory, such as "loops/nested", and the expected output and input
+// files use the same relative path.
 func (bt *BasicTester) GetTestName(filePath string) string {
-	base := filepath.Base(filePath)
-	return strings.TrimSuffix(base, ".bas")
+	name := filepath.Base(filePath)
+	for _, dir := range []string{bt.testsDir, bt.errorsDir} {
+		if rel, err := filepath.Rel(dir, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+			name = filepath.ToSlash(rel)
+			break
+		}
+	}
+	return strings.TrimSuffix(name, ".bas")
+}
+
+// filterTests keeps the files whose test names contain the -run filter,
+// ignoring case, and counts the rest as skipped
+func (bt *BasicTester) filterTests(files []string) []string {
+	if bt.runFilter == "" {
+		return files
+	}
+	filter := strings.ToLower(bt.runFilter)
+	var kept []string
+	for _, file := range files {
+		if strings.Contains(strings.ToLower(bt.GetTestName(file)), filter) {
+			kept = append(kept, file)
+		} else {
+			bt.filteredCount++
+		}
+	}
+	return kept
 }
 
-// RunSuccessTests runs all success tests and reports results
+// paint wraps text in an ANSI color when color output is enabled
+func (bt *BasicTester) paint(color, text string) string {
+	if !bt.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (bt *BasicTester) pass() string { return bt.paint(colorGreen, "PASS") }
+func (bt *BasicTester) fail() string { return bt.paint(colorRed, "FAIL") }
+func (bt *BasicTester) skip() string { return bt.paint(colorYellow, "SKIP") }
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// recordFailure counts a failed test and remembers the first one for -fail-fast
+func (bt *BasicTester) recordFailure(testFile string) {
+	bt.failCount++
+	if bt.firstFailure == "" {
+		bt.firstFailure = testFile
+	}
+}
+
+// output returns where the report is printed
+func (bt *BasicTester) output() io.Writer {
+	if bt.out == nil {
+		return os.Stdout
+	}
+	return bt.out
+}
+
+// stopRequested returns true once a test has failed in fail-fast mode
+func (bt *BasicTester) stopRequested() bool {
+	return bt.failFast && bt.failCount > 0
+}
+
+// RunSuccessTests runs all success tests and reports results. Up to
+// bt.jobs tests run at once; their results are printed in file order.
 func (bt *BasicTester) RunSuccessTests() {
-	fmt.Println("=== Running Success Tests ===")
+	if bt.stopRequested() {
+		return
+	}
+	fmt.Fprintln(bt.output(), "=== Running Success Tests ===")
 	
 	testFiles, err := bt.GetBasicFiles()
 	if err != nil {
-		fmt.Printf("Error getting test files: %v\n", err)
+		fmt.Fprintf(bt.output(), "Error getting test files: %v\n", err)
 		return
 	}
 
 	if len(testFiles) == 0 {
-		fmt.Println("No test files found in tests/basic/")
+		fmt.Fprintln(bt.output(), bt.skip() + " No test files found in tests/basic/")
+		return
+	}
+	if testFiles = bt.filterTests(testFiles); len(testFiles) == 0 {
+		fmt.Fprintln(bt.output(), bt.skip() + " No success tests match -run " + bt.runFilter)
 		return
 	}
 
-	for _, testFile := range testFiles {
-		testName := bt.GetTestName(testFile)
-		fmt.Printf("Running %s... ", testName)
+	jobs := bt.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(testFiles) {
+		jobs = len(testFiles)
+	}
 
-		// Read BASIC source code for verbose output
-		var sourceCode string
-		if bt.verbose {
-			if content, err := ioutil.ReadFile(testFile); err == nil {
-				sourceCode = strings.TrimSpace(string(content))
+	// Each test's result is delivered on its own channel, so they can be
+	// printed in order as soon as the earlier ones are done
+	results := make([]chan testResult, len(testFiles))
+	for i := range results {
+		results[i] = make(chan testResult, 1)
+	}
+	next := make(chan int)
+	stop := make(chan struct{})
+	defer close(stop)
+	for w := 0; w < jobs; w++ {
+		go func() {
+			for i := range next {
+				results[i] <- bt.runSuccessTest(testFiles[i])
 			}
-		}
-
-		// Run the BASIC program
-		actualOutput, err := bt.RunBasicFile(testFile)
-		if err != nil {
-			fmt.Printf("FAIL (execution error: %v)\n", err)
-			if bt.verbose && sourceCode != "" {
-				fmt.Printf("  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+		}()
+	}
+	go func() {
+		defer close(next)
+		for i := range testFiles {
+			select {
+			case next <- i:
+			case <-stop:
+				return
 			}
-			bt.failCount++
-			continue
 		}
+	}()
 
-		// Read expected output
-		expectedOutput, err := bt.ReadExpectedOutput(testName)
-		if err != nil {
-			fmt.Printf("FAIL (missing expected output: %v)\n", err)
-			if bt.verbose && sourceCode != "" {
-				fmt.Printf("  BASIC code:\n%s\n", bt.indentLines(sourceCode))
-			}
-			bt.failCount++
-			continue
+	for i, testFile := range testFiles {
+		if bt.stopRequested() {
+			return
 		}
-
-		// Compare outputs
-		if actualOutput == expectedOutput {
-			fmt.Println("PASS")
-			if bt.verbose {
-				if sourceCode != "" {
-					fmt.Printf("  BASIC code:\n%s\n", bt.indentLines(sourceCode))
-				}
-				fmt.Printf("  Output: %q\n", actualOutput)
-			}
+		result := <-results[i]
+		fmt.Fprint(bt.output(), result.report)
+		bt.addCase("success", bt.GetTestName(testFile), result)
+		if result.passed {
 			bt.passCount++
 		} else {
-			fmt.Printf("FAIL (output mismatch)\n")
-			if bt.verbose && sourceCode != "" {
-				fmt.Printf("  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+			bt.recordFailure(testFile)
+		}
+	}
+}
+
+// testResult is the outcome of one test and the text reporting it
+type testResult struct {
+	passed   bool
+	report   string
+	message  string // why the test failed
+	duration time.Duration
+}
+
+// runSuccessTest runs one success test. It only builds its report, so it
+// can run alongside other tests.
+func (bt *BasicTester) runSuccessTest(testFile string) testResult {
+	var out strings.Builder
+	testName := bt.GetTestName(testFile)
+	fmt.Fprintf(&out, "Running %s... ", testName)
+	start := time.Now()
+
+	// Read BASIC source code for verbose output
+	var sourceCode string
+	if bt.verbose {
+		if content, err := ioutil.ReadFile(testFile); err == nil {
+			sourceCode = strings.TrimSpace(string(content))
+		}
+	}
+
+	// Run the BASIC program
+	actualOutput, err := bt.RunBasicFile(testFile)
+	duration := time.Since(start)
+	if err != nil {
+		fmt.Fprintf(&out, "%s (execution error: %v)\n", bt.fail(), err)
+		if bt.verbose && sourceCode != "" {
+			fmt.Fprintf(&out, "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+		}
+		if bt.verbose && actualOutput != "" {
+			fmt.Fprintf(&out, "  Output before error: %q\n", actualOutput)
+		}
+		return testResult{report: out.String(), message: fmt.Sprintf("execution error: %v", err), duration: duration}
+	}
+
+	// Read expected output
+	expectedOutput, err := bt.ReadExpectedOutput(testName)
+	if err != nil {
+		fmt.Fprintf(&out, "%s (missing expected output: %v)\n", bt.fail(), err)
+		if bt.verbose && sourceCode != "" {
+			fmt.Fprintf(&out, "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+		}
+		return testResult{report: out.String(), message: fmt.Sprintf("missing expected output: %v", err), duration: duration}
+	}
+
+	// Compare outputs
+	if outputsMatch(expectedOutput, actualOutput, bt.strict) {
+		fmt.Fprintln(&out, bt.pass())
+		if bt.verbose {
+			if sourceCode != "" {
+				fmt.Fprintf(&out, "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
 			}
-			fmt.Printf("  Expected: %q\n", expectedOutput)
-			fmt.Printf("  Actual:   %q\n", actualOutput)
-			bt.failCount++
+			fmt.Fprintf(&out, "  Output: %q\n", actualOutput)
 		}
+		return testResult{passed: true, report: out.String(), duration: duration}
+	}
+
+	fmt.Fprintf(&out, "%s (output mismatch)\n", bt.fail())
+	if bt.verbose && sourceCode != "" {
+		fmt.Fprintf(&out, "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
 	}
+	out.WriteString(bt.outputDiff(expectedOutput, actualOutput))
+	message := fmt.Sprintf("output mismatch: expected %q, got %q", expectedOutput, actualOutput)
+	return testResult{report: out.String(), message: message, duration: duration}
 }
 
 // RunErrorTests runs all error tests and reports results
 func (bt *BasicTester) RunErrorTests() {
-	fmt.Println("\n=== Running Error Tests ===")
+	if bt.stopRequested() {
+		return
+	}
+	fmt.Fprintln(bt.output(), "\n=== Running Error Tests ===")
 	
 	errorFiles, err := bt.GetErrorFiles()
 	if err != nil {
-		fmt.Printf("Error getting error test files: %v\n", err)
+		fmt.Fprintf(bt.output(), "Error getting error test files: %v\n", err)
 		return
 	}
 
 	if len(errorFiles) == 0 {
-		fmt.Println("No error test files found in tests/errors/")
+		fmt.Fprintln(bt.output(), bt.skip() + " No error test files found in tests/errors/")
+		return
+	}
+	if errorFiles = bt.filterTests(errorFiles); len(errorFiles) == 0 {
+		fmt.Fprintln(bt.output(), bt.skip() + " No error tests match -run " + bt.runFilter)
 		return
 	}
 
 	for _, errorFile := range errorFiles {
+		if bt.stopRequested() {
+			return
+		}
 		testName := bt.GetTestName(errorFile)
-		fmt.Printf("Running %s... ", testName)
+		fmt.Fprintf(bt.output(), "Running %s... ", testName)
 
 		// Read BASIC source code for verbose output
 		var sourceCode string
@@ -181,74 +445,278 @@ func (bt *BasicTester) RunErrorTests() {
 			}
 		}
 
-		// This should fail
+		// This should fail, with the expected message if there is one
+		expectedError, checkMessage, readErr := bt.ReadExpectedError(testName)
+		if readErr != nil {
+			fmt.Fprintf(bt.output(), "%s (failed to read expected error: %v)\n", bt.fail(), readErr)
+			bt.addCase("errors", testName, testResult{message: fmt.Sprintf("failed to read expected error: %v", readErr)})
+			bt.recordFailure(errorFile)
+			continue
+		}
+		start := time.Now()
 		output, err := bt.RunBasicFile(errorFile)
-		if err != nil {
-			fmt.Println("PASS (correctly failed)")
+		duration := time.Since(start)
+		var interpErr *InterpreterError
+		if err != nil && checkMessage && errors.As(err, &interpErr) && !strings.Contains(interpErr.Stderr, expectedError) {
+			fmt.Fprintf(bt.output(), "%s (wrong error message)\n", bt.fail())
+			if bt.verbose && sourceCode != "" {
+				fmt.Fprintf(bt.output(), "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+			}
+			fmt.Fprintf(bt.output(), "  Expected error containing: %q\n", expectedError)
+			fmt.Fprintf(bt.output(), "  Actual stderr:             %q\n", interpErr.Stderr)
+			message := fmt.Sprintf("expected error containing %q, got stderr %q", expectedError, interpErr.Stderr)
+			bt.addCase("errors", testName, testResult{message: message, duration: duration})
+			bt.recordFailure(errorFile)
+		} else if err != nil {
+			fmt.Fprintln(bt.output(), bt.pass() + " (correctly failed)")
 			if bt.verbose {
 				if sourceCode != "" {
-					fmt.Printf("  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+					fmt.Fprintf(bt.output(), "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+				}
+				fmt.Fprintf(bt.output(), "  Error: %v\n", err)
+				if output != "" {
+					fmt.Fprintf(bt.output(), "  Output before error: %q\n", output)
 				}
-				fmt.Printf("  Error: %v\n", err)
 			}
+			bt.addCase("errors", testName, testResult{passed: true, duration: duration})
 			bt.passCount++
 		} else {
-			fmt.Println("FAIL (should have failed but succeeded)")
+			fmt.Fprintln(bt.output(), bt.fail() + " (should have failed but succeeded)")
 			if bt.verbose {
 				if sourceCode != "" {
-					fmt.Printf("  BASIC code:\n%s\n", bt.indentLines(sourceCode))
+					fmt.Fprintf(bt.output(), "  BASIC code:\n%s\n", bt.indentLines(sourceCode))
 				}
-				fmt.Printf("  Unexpected output: %q\n", output)
+				fmt.Fprintf(bt.output(), "  Unexpected output: %q\n", output)
 			}
-			bt.failCount++
+			bt.addCase("errors", testName, testResult{message: "should have failed but succeeded", duration: duration})
+			bt.recordFailure(errorFile)
 		}
 	}
 }
 
 // RunManualTests runs some manual verification tests
 func (bt *BasicTester) RunManualTests() {
-	fmt.Println("\n=== Running Manual Tests ===")
+	if bt.stopRequested() {
+		return
+	}
+	fmt.Fprintln(bt.output(), "\n=== Running Manual Tests ===")
 	
 	// Test sample program if it exists
 	if _, err := os.Stat("test_sample.bas"); err == nil {
-		fmt.Printf("Running test_sample.bas... ")
+		fmt.Fprintf(bt.output(), "Running test_sample.bas... ")
+		start := time.Now()
 		output, err := bt.RunBasicFile("test_sample.bas")
+		duration := time.Since(start)
 		if err != nil {
-			fmt.Printf("FAIL (execution error: %v)\n", err)
-			bt.failCount++
+			fmt.Fprintf(bt.output(), "%s (execution error: %v)\n", bt.fail(), err)
+			bt.addCase("manual", "test_sample", testResult{message: fmt.Sprintf("execution error: %v", err), duration: duration})
+			bt.recordFailure("test_sample.bas")
 		} else {
 			// Basic sanity checks
 			if strings.Contains(output, "BASIC Interpreter Test") && 
 			   strings.Contains(output, "Program completed successfully") {
-				fmt.Println("PASS")
+				fmt.Fprintln(bt.output(), bt.pass())
 				if bt.verbose {
-					fmt.Printf("  Output: %q\n", output)
+					fmt.Fprintf(bt.output(), "  Output: %q\n", output)
 				}
+				bt.addCase("manual", "test_sample", testResult{passed: true, duration: duration})
 				bt.passCount++
 			} else {
-				fmt.Println("FAIL (unexpected output)")
+				fmt.Fprintln(bt.output(), bt.fail() + " (unexpected output)")
 				if bt.verbose {
-					fmt.Printf("  Output: %q\n", output)
+					fmt.Fprintf(bt.output(), "  Output: %q\n", output)
 				}
-				bt.failCount++
+				bt.addCase("manual", "test_sample", testResult{message: fmt.Sprintf("unexpected output: %q", output), duration: duration})
+				bt.recordFailure("test_sample.bas")
 			}
 		}
+	} else {
+		fmt.Fprintln(bt.output(), bt.skip() + " test_sample.bas not found")
 	}
 }
 
 // PrintSummary prints the test results summary
 func (bt *BasicTester) PrintSummary() {
-	fmt.Println("\n=== Test Summary ===")
+	fmt.Fprintln(bt.output(), "\n=== Test Summary ===")
 	total := bt.passCount + bt.failCount
-	fmt.Printf("Tests run: %d\n", total)
-	fmt.Printf("Passed: %d\n", bt.passCount)
-	fmt.Printf("Failed: %d\n", bt.failCount)
+	fmt.Fprintf(bt.output(), "Tests run: %d\n", total)
+	fmt.Fprintf(bt.output(), "Passed: %d\n", bt.passCount)
+	fmt.Fprintf(bt.output(), "Failed: %d\n", bt.failCount)
+	if bt.runFilter != "" {
+		fmt.Fprintf(bt.output(), "Skipped by -run %s: %d\n", bt.runFilter, bt.filteredCount)
+	}
+	fmt.Fprintf(bt.output(), "Total time: %v\n", time.Since(bt.startTime).Round(time.Millisecond))
+	if slowest := bt.SlowestTests(1); len(slowest) > 0 {
+		fmt.Fprintf(bt.output(), "Slowest test: %s (%v)\n", slowest[0].name, slowest[0].duration.Round(time.Millisecond))
+	}
+	if bt.showTimings && len(bt.timings) > 0 {
+		var total time.Duration
+		for _, t := range bt.timings {
+			total += t.duration
+		}
+		fmt.Fprintf(bt.output(), "Time in interpreter: %v over %d run(s)\n", total.Round(time.Millisecond), len(bt.timings))
+		fmt.Fprintln(bt.output(), "Slowest tests:")
+		for i, t := range bt.SlowestTests(slowestShown) {
+			fmt.Fprintf(bt.output(), "  %2d. %-30s %v\n", i+1, t.name, t.duration.Round(time.Microsecond))
+		}
+	}
+
+	if bt.stopRequested() {
+		fmt.Fprintf(bt.output(), "Stopped after first failure (-fail-fast): %s\n", bt.firstFailure)
+		if !bt.verbose {
+			if content, err := ioutil.ReadFile(bt.firstFailure); err == nil {
+				fmt.Fprintf(bt.output(), "  BASIC code:\n%s\n", bt.indentLines(strings.TrimSpace(string(content))))
+			}
+		}
+	}
 	
 	if bt.failCount == 0 {
-		fmt.Println("✅ All tests passed!")
+		fmt.Fprintln(bt.output(), "✅ All tests passed!")
 	} else {
-		fmt.Printf("❌ %d test(s) failed\n", bt.failCount)
+		fmt.Fprintf(bt.output(), "❌ %d test(s) failed\n", bt.failCount)
+	}
+}
+
+// outputsMatch compares expected and actual output. Unless strict, a
+// single trailing newline is trimmed from each first, so an expected output
+// file saved with or without a final newline matches either way.
+func outputsMatch(expected, actual string, strict bool) bool {
+	if !strict {
+		expected = strings.TrimSuffix(expected, "\n")
+		actual = strings.TrimSuffix(actual, "\n")
+	}
+	return expected == actual
+}
+
+// diffContext is the number of matching lines shown around each change
+const diffContext = 2
+
+// outputDiff renders a line-by-line unified diff from the expected to the
+// actual output, indented for the report, with removed lines in red and
+// added lines in green when color is enabled
+func (bt *BasicTester) outputDiff(expected, actual string) string {
+	ops := diffLines(outputLines(expected), outputLines(actual))
+
+	var sb strings.Builder
+	sb.WriteString("    " + bt.paint(colorRed, "--- expected") + "\n")
+	sb.WriteString("    " + bt.paint(colorGreen, "+++ actual") + "\n")
+
+	// Expected and actual line numbers before each op
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		last := i
+		for j := i + 1; j < len(ops) && j <= last+2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			}
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		fmt.Fprintf(&sb, "    @@ -%d,%d +%d,%d @@\n", oldLine[start]+1, oldLine[end]-oldLine[start], newLine[start]+1, newLine[end]-newLine[start])
+		for _, op := range ops[start:end] {
+			line := string(op.kind) + op.text
+			switch op.kind {
+			case '-':
+				line = bt.paint(colorRed, line)
+			case '+':
+				line = bt.paint(colorGreen, line)
+			}
+			sb.WriteString("    " + line + "\n")
+		}
+		i = end
+	}
+
+	// A difference only in the final newline leaves no changed lines
+	if strings.HasSuffix(expected, "\n") != strings.HasSuffix(actual, "\n") {
+		if strings.HasSuffix(expected, "\n") {
+			sb.WriteString("    \\ Actual output has no newline at the end\n")
+		} else {
+			sb.WriteString("    \\ Expected output has no newline at the end\n")
+		}
+	}
+	return sb.String()
+}
+
+// diffOp is one line of a line diff: ' ' matching, '-' only expected, '+' only actual
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffLines computes a line diff using the longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// outputLines splits program output into lines without a trailing empty element
+func outputLines(text string) []string {
+	if text == "" {
+		return nil
 	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
 }
 
 // indentLines adds 4-space indentation to each line
@@ -260,6 +728,115 @@ func (bt *BasicTester) indentLines(text string) string {
 	return strings.Join(lines, "\n")
 }
 
+// junitSuites is the root of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite is one of the success, errors and manual suites
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+// junitCase is one test file's result
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	duration  time.Duration
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// addCase records a finished test for the JUnit report
+func (bt *BasicTester) addCase(suite, name string, result testResult) {
+	c := junitCase{
+		Name:      name,
+		Classname: suite,
+		Time:      junitSeconds(result.duration),
+		duration:  result.duration,
+	}
+	if !result.passed {
+		c.Failure = &junitFailure{Message: result.message, Text: result.message}
+	}
+	bt.cases = append(bt.cases, c)
+}
+
+// junitSeconds formats a duration the way JUnit reports expect
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// WriteJUnit writes the results of the tests run so far to path as JUnit
+// XML, with one testsuite per suite that ran
+func (bt *BasicTester) WriteJUnit(path string) error {
+	report := junitSuites{Time: junitSeconds(time.Since(bt.startTime))}
+	for _, name := range []string{"success", "errors", "manual"} {
+		suite := junitSuite{Name: name}
+		var total time.Duration
+		for _, c := range bt.cases {
+			if c.Classname != name {
+				continue
+			}
+			suite.Cases = append(suite.Cases, c)
+			suite.Tests++
+			if c.Failure != nil {
+				suite.Failures++
+			}
+			total += c.duration
+		}
+		if suite.Tests == 0 {
+			continue
+		}
+		suite.Time = junitSeconds(total)
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// WriteTAP writes the results of the tests run so far as TAP version 13,
+// numbering the success, errors and manual suites into one plan. Failures
+// carry a YAML diagnostic block.
+func (bt *BasicTester) WriteTAP(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("TAP version 13\n")
+	fmt.Fprintf(&sb, "1..%d\n", len(bt.cases))
+	for i, c := range bt.cases {
+		if c.Failure == nil {
+			fmt.Fprintf(&sb, "ok %d - %s/%s\n", i+1, c.Classname, c.Name)
+			continue
+		}
+		fmt.Fprintf(&sb, "not ok %d - %s/%s\n", i+1, c.Classname, c.Name)
+		sb.WriteString("  ---\n")
+		fmt.Fprintf(&sb, "  message: %s\n", strconv.Quote(c.Failure.Message))
+		sb.WriteString("  severity: fail\n")
+		fmt.Fprintf(&sb, "  suite: %s\n", c.Classname)
+		fmt.Fprintf(&sb, "  duration_ms: %.3f\n", float64(c.duration)/float64(time.Millisecond))
+		sb.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
 // HasFailures returns true if any tests failed
 func (bt *BasicTester) HasFailures() bool {
 	return bt.failCount > 0
@@ -268,12 +845,87 @@ func (bt *BasicTester) HasFailures() bool {
 func main() {
 	var interpreterPath string
 	var verbose bool
+	var failFast bool
+	var only string
+	var skipManual bool
+	var extraArgs []string
+	var extraEnv []string
+	jobs := runtime.NumCPU()
+	var junitPath string
+	var strict bool
+	var runFilter string
+	var timings bool
+	var tap bool
+	color := isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
 	
 	// Parse command line arguments
 	args := os.Args[1:]
-	for _, arg := range args {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
 		if arg == "-v" || arg == "--verbose" {
 			verbose = true
+		} else if arg == "-fail-fast" || arg == "--fail-fast" {
+			failFast = true
+		} else if arg == "-no-color" || arg == "--no-color" {
+			color = false
+		} else if arg == "-color" || arg == "--color" {
+			color = true
+		} else if arg == "-only" || arg == "--only" {
+			if i+1 < len(args) {
+				i++
+				only = args[i]
+			}
+			if only != "success" && only != "errors" {
+				fmt.Println("Error: -only must be followed by 'success' or 'errors'")
+				os.Exit(1)
+			}
+		} else if arg == "-skip-manual" || arg == "--skip-manual" {
+			skipManual = true
+		} else if arg == "-arg" || arg == "--arg" {
+			if i+1 >= len(args) {
+				fmt.Println("Error: -arg must be followed by an interpreter argument")
+				os.Exit(1)
+			}
+			i++
+			extraArgs = append(extraArgs, args[i])
+		} else if arg == "-env" || arg == "--env" {
+			if i+1 >= len(args) || !strings.Contains(args[i+1], "=") {
+				fmt.Println("Error: -env must be followed by NAME=VALUE")
+				os.Exit(1)
+			}
+			i++
+			extraEnv = append(extraEnv, args[i])
+		} else if arg == "-jobs" || arg == "--jobs" {
+			n := 0
+			if i+1 < len(args) {
+				i++
+				n, _ = strconv.Atoi(args[i])
+			}
+			if n < 1 {
+				fmt.Println("Error: -jobs must be followed by a positive number")
+				os.Exit(1)
+			}
+			jobs = n
+		} else if arg == "-tap" || arg == "--tap" {
+			tap = true
+		} else if arg == "-timings" || arg == "--timings" {
+			timings = true
+		} else if arg == "-run" || arg == "--run" {
+			if i+1 >= len(args) {
+				fmt.Println("Error: -run must be followed by part of a test name")
+				os.Exit(1)
+			}
+			i++
+			runFilter = args[i]
+		} else if arg == "-strict" || arg == "--strict" {
+			strict = true
+		} else if arg == "-junit" || arg == "--junit" {
+			if i+1 >= len(args) {
+				fmt.Println("Error: -junit must be followed by an output file path")
+				os.Exit(1)
+			}
+			i++
+			junitPath = args[i]
 		} else if !strings.HasPrefix(arg, "-") {
 			interpreterPath = arg
 			break
@@ -293,11 +945,25 @@ func main() {
 		fmt.Println()
 		fmt.Println("Options:")
 		fmt.Println("  -v, --verbose    Show detailed output for each test")
+		fmt.Println("  -fail-fast       Stop at the first failing test")
+		fmt.Println("  -color           Force colored PASS/FAIL output")
+		fmt.Println("  -no-color        Disable colored output (also NO_COLOR=1)")
+		fmt.Println("  -only <suite>    Run only the 'success' or 'errors' suite")
+		fmt.Println("  -skip-manual     Skip the manual tests")
+		fmt.Println("  -arg <value>     Pass an extra argument to the interpreter (repeatable)")
+		fmt.Println("  -env NAME=VALUE  Set an environment variable for the interpreter (repeatable)")
+		fmt.Println("  -jobs <n>        Run up to n success tests at once (default: number of CPUs)")
+		fmt.Println("  -junit <path>    Also write the results as JUnit XML to path")
+		fmt.Println("  -strict          Require output to match exactly, including a trailing newline")
+		fmt.Println("  -run <text>      Only run success and error tests whose name contains text (any case)")
+		fmt.Println("  -timings         List the slowest tests and the time spent in the interpreter")
+		fmt.Println("  -tap             Write TAP version 13 to stdout; the usual report goes to stderr")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  go run test_runner.go ./basic")
 		fmt.Println("  go run test_runner.go -v ./basic")
 		fmt.Println("  go run test_runner.go --verbose /usr/local/bin/my_basic")
+		fmt.Println("  go run test_runner.go -arg --dialect -arg gwbasic ./basic")
 		os.Exit(1)
 	}
 
@@ -312,20 +978,54 @@ func main() {
 		interpreterPath = "./" + interpreterPath
 	}
 
-	fmt.Printf("Testing BASIC interpreter: %s\n", interpreterPath)
+	// In TAP mode stdout carries only TAP, so the usual report goes to stderr
+	var report io.Writer = os.Stdout
+	if tap {
+		report = os.Stderr
+		color = color && isTerminal(os.Stderr)
+	}
+
+	fmt.Fprintf(report, "Testing BASIC interpreter: %s\n", interpreterPath)
 	if verbose {
-		fmt.Println("Verbose mode enabled - showing detailed output")
+		fmt.Fprintln(report, "Verbose mode enabled - showing detailed output")
 	}
 	
 	tester := NewBasicTester(interpreterPath, verbose)
+	tester.out = report
+	tester.failFast = failFast
+	tester.color = color
+	tester.extraArgs = extraArgs
+	tester.extraEnv = extraEnv
+	tester.jobs = jobs
+	tester.strict = strict
+	tester.runFilter = runFilter
+	tester.showTimings = timings
 	
-	// Run all test suites
-	tester.RunSuccessTests()
-	tester.RunErrorTests()
-	tester.RunManualTests()
+	// Run the selected test suites
+	if only != "errors" {
+		tester.RunSuccessTests()
+	}
+	if only != "success" {
+		tester.RunErrorTests()
+	}
+	if only == "" && !skipManual {
+		tester.RunManualTests()
+	}
 	
 	// Print summary and exit with appropriate code
 	tester.PrintSummary()
+	if tap {
+		if err := tester.WriteTAP(os.Stdout); err != nil {
+			fmt.Fprintf(report, "Error writing TAP output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if junitPath != "" {
+		if err := tester.WriteJUnit(junitPath); err != nil {
+			fmt.Fprintf(report, "Error writing JUnit report: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	
 	if tester.HasFailures() {
 		os.Exit(1)
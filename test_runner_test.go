@@ -0,0 +1,720 @@
+package main
+
+// Run with go test test_runner.go test_runner_test.go
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The tests run this test binary as the interpreter: with
+// BASIC_FAKE_INTERPRETER set, TestFakeInterpreter runs the program file
+// named by the last argument, which holds one command per line:
+//
+//	PRINT text     print text
+//	FAIL message   print message to stderr and exit with status 1
+//	SLEEP ms       pause
+//	ECHOINPUT      copy standard input to standard output
+//	ARGS           print the arguments before the program file
+//	ENV name       print an environment variable
+var fakeArgs = []string{"-test.run=^TestFakeInterpreter$", "--"}
+
+func TestFakeInterpreter(t *testing.T) {
+	if os.Getenv("BASIC_FAKE_INTERPRETER") != "1" {
+		return
+	}
+	args := flag.Args()
+	program, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(program)), "\n") {
+		command, operand, _ := strings.Cut(line, " ")
+		switch command {
+		case "PRINT":
+			fmt.Println(operand)
+		case "FAIL":
+			fmt.Fprintln(os.Stderr, operand)
+			os.Exit(1)
+		case "SLEEP":
+			var ms int
+			fmt.Sscan(operand, &ms)
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+		case "ECHOINPUT":
+			io.Copy(os.Stdout, bufio.NewReader(os.Stdin))
+		case "ARGS":
+			fmt.Println(strings.Join(args[:len(args)-1], " "))
+		case "ENV":
+			fmt.Println(os.Getenv(operand))
+		}
+	}
+	os.Exit(0)
+}
+
+// newFakeTester returns a tester running the fake interpreter on a tests
+// tree made of files, which maps paths such as "tests/basic/hello.bas" to
+// their contents
+func newFakeTester(t *testing.T, files map[string]string) *BasicTester {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bt := NewBasicTester(os.Args[0], false)
+	bt.testsDir = filepath.Join(dir, "tests", "basic")
+	bt.expectedDir = filepath.Join(dir, "tests", "expected")
+	bt.errorsDir = filepath.Join(dir, "tests", "errors")
+	bt.inputDir = filepath.Join(dir, "tests", "input")
+	bt.extraArgs = append([]string{}, fakeArgs...)
+	bt.extraEnv = []string{"BASIC_FAKE_INTERPRETER=1"}
+	return bt
+}
+
+// runRunner runs the test runner's main in a child process, in the
+// directory holding bt's tests tree, with args followed by the options that
+// make it use the fake interpreter. It returns the combined output.
+func runRunner(t *testing.T, bt *BasicTester, args ...string) (string, error) {
+	t.Helper()
+	for _, arg := range fakeArgs {
+		args = append(args, "-arg", arg)
+	}
+	args = append(args, "-env", "BASIC_FAKE_INTERPRETER=1", os.Args[0])
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunnerHelper$")
+	cmd.Dir = filepath.Dir(filepath.Dir(bt.testsDir))
+	cmd.Env = append(os.Environ(), "BASIC_TEST_RUNNER=1", "BASIC_TEST_RUNNER_ARGS="+strings.Join(args, "\n"))
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// TestRunnerHelper is not a real test: runRunner runs it as the test runner
+func TestRunnerHelper(t *testing.T) {
+	if os.Getenv("BASIC_TEST_RUNNER") != "1" {
+		return
+	}
+	os.Args = append([]string{"test_runner"}, strings.Split(os.Getenv("BASIC_TEST_RUNNER_ARGS"), "\n")...)
+	main()
+	os.Exit(0)
+}
+
+// captureStdout returns what run prints to standard output
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	defer func() { os.Stdout = stdout }()
+
+	run()
+	w.Close()
+	return <-done
+}
+
+func TestFailFastStopsAtFirstFailure(t *testing.T) {
+	files := map[string]string{
+		"tests/basic/a.bas":      "PRINT wrong",
+		"tests/expected/a.txt":   "right\n",
+		"tests/basic/b.bas":      "PRINT b",
+		"tests/expected/b.txt":   "b\n",
+		"tests/errors/error.bas": "FAIL boom",
+	}
+
+	bt := newFakeTester(t, files)
+	bt.failFast = true
+	report := captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.RunErrorTests()
+		bt.PrintSummary()
+	})
+	if bt.passCount != 0 || bt.failCount != 1 {
+		t.Errorf("%d passed and %d failed, want only the first test to run and fail", bt.passCount, bt.failCount)
+	}
+	if strings.Contains(report, "Running b") || strings.Contains(report, "Error Tests") {
+		t.Errorf("tests ran after the first failure:\n%s", report)
+	}
+	if !strings.Contains(report, "Stopped after first failure (-fail-fast): "+filepath.Join(bt.testsDir, "a.bas")) {
+		t.Errorf("summary does not name the failing test:\n%s", report)
+	}
+
+	bt = newFakeTester(t, files)
+	captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.RunErrorTests()
+	})
+	if bt.passCount != 2 || bt.failCount != 1 {
+		t.Errorf("without -fail-fast %d passed and %d failed, want 2 and 1", bt.passCount, bt.failCount)
+	}
+}
+
+func TestStatusColors(t *testing.T) {
+	files := map[string]string{
+		"tests/basic/good.bas":    "PRINT ok",
+		"tests/expected/good.txt": "ok\n",
+		"tests/basic/bad.bas":     "PRINT wrong",
+		"tests/expected/bad.txt":  "right\n",
+	}
+
+	bt := newFakeTester(t, files)
+	bt.color = true
+	report := captureStdout(t, bt.RunSuccessTests)
+	for _, want := range []string{colorGreen + "PASS" + colorReset, colorRed + "FAIL" + colorReset} {
+		if !strings.Contains(report, want) {
+			t.Errorf("colored report lacks %q:\n%s", want, report)
+		}
+	}
+
+	bt = newFakeTester(t, files)
+	report = captureStdout(t, bt.RunSuccessTests)
+	if strings.Contains(report, "\033[") {
+		t.Errorf("report has color codes with color off:\n%q", report)
+	}
+	if !strings.Contains(report, "PASS") || !strings.Contains(report, "FAIL") {
+		t.Errorf("plain report lacks PASS or FAIL:\n%s", report)
+	}
+
+	bt = newFakeTester(t, nil)
+	bt.color = true
+	if report := captureStdout(t, bt.RunSuccessTests); !strings.Contains(report, colorYellow+"SKIP"+colorReset) {
+		t.Errorf("empty suite not reported with a yellow SKIP:\n%s", report)
+	}
+}
+
+func TestSummaryReportsSlowestTest(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/quick.bas":    "PRINT q",
+		"tests/expected/quick.txt": "q\n",
+		"tests/basic/slow.bas":     "SLEEP 200\nPRINT s",
+		"tests/expected/slow.txt":  "s\n",
+	})
+	bt.jobs = 1
+	report := captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.PrintSummary()
+	})
+
+	slowest := bt.SlowestTests(1)
+	if len(slowest) != 1 || slowest[0].name != "slow" || slowest[0].duration < 200*time.Millisecond {
+		t.Fatalf("slowest test %v, want slow taking at least 200ms", slowest)
+	}
+	if !strings.Contains(report, "Slowest test: slow (") {
+		t.Errorf("summary does not name the slowest test:\n%s", report)
+	}
+	_, total, _ := strings.Cut(report, "Total time: ")
+	total, _, _ = strings.Cut(total, "\n")
+	if d, err := time.ParseDuration(total); err != nil || d < slowest[0].duration.Round(time.Millisecond) || d > time.Minute {
+		t.Errorf("implausible total time %q", total)
+	}
+}
+
+func TestSuiteSelection(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/good.bas":    "PRINT ok",
+		"tests/expected/good.txt": "ok\n",
+		"tests/errors/bad.bas":    "FAIL boom",
+	})
+	for _, test := range []struct {
+		args []string
+		want []string // suites that should run
+	}{
+		{nil, []string{"Success", "Error", "Manual"}},
+		{[]string{"-only", "errors"}, []string{"Error"}},
+		{[]string{"-only", "success"}, []string{"Success"}},
+		{[]string{"-skip-manual"}, []string{"Success", "Error"}},
+	} {
+		output, err := runRunner(t, bt, append(test.args, "-no-color")...)
+		if err != nil {
+			t.Errorf("%v: %v\n%s", test.args, err, output)
+			continue
+		}
+		for _, suite := range []string{"Success", "Error", "Manual"} {
+			ran := strings.Contains(output, "=== Running "+suite+" Tests ===")
+			want := strings.Contains(strings.Join(test.want, " "), suite)
+			if ran != want {
+				t.Errorf("%v: %s suite ran: %v, want %v\n%s", test.args, suite, ran, want, output)
+			}
+		}
+	}
+}
+
+func TestRunBasicFileKeepsOutputBeforeError(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/errors/partial.bas": "PRINT one\nPRINT two\nFAIL division by zero",
+	})
+	output, err := bt.RunBasicFile(filepath.Join(bt.errorsDir, "partial.bas"))
+	if output != "one\ntwo\n" {
+		t.Errorf("output %q, want the two lines printed before the error", output)
+	}
+	var interpErr *InterpreterError
+	if !errors.As(err, &interpErr) || !strings.Contains(interpErr.Stderr, "division by zero") {
+		t.Errorf("got %v, want an InterpreterError with the stderr", err)
+	}
+}
+
+func TestExtraArgsAndEnvForwarded(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/invoke.bas": "ARGS\nENV BASIC_DIALECT",
+	})
+	bt.extraArgs = append(bt.extraArgs, "--dialect", "gwbasic")
+	bt.extraEnv = append(bt.extraEnv, "BASIC_DIALECT=gwbasic")
+
+	output, err := bt.RunBasicFile(filepath.Join(bt.testsDir, "invoke.bas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "--dialect gwbasic\ngwbasic\n" {
+		t.Errorf("interpreter saw %q, want the extra argument and variable", output)
+	}
+}
+
+func TestParallelResultsMatchSequential(t *testing.T) {
+	// Earlier tests sleep longer, so in parallel they finish out of order
+	files := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("t%d", i)
+		files["tests/basic/"+name+".bas"] = fmt.Sprintf("SLEEP %d\nPRINT %s", (8-i)*10, name)
+		expected := name
+		if i%3 == 0 {
+			expected = "something else"
+		}
+		files["tests/expected/"+name+".txt"] = expected + "\n"
+	}
+
+	sequential := newFakeTester(t, files)
+	sequentialReport := captureStdout(t, sequential.RunSuccessTests)
+
+	parallel := newFakeTester(t, files)
+	parallel.jobs = 4
+	parallelReport := captureStdout(t, parallel.RunSuccessTests)
+
+	if parallelReport != sequentialReport {
+		t.Errorf("parallel report differs from the sequential one:\n%s\nwant:\n%s", parallelReport, sequentialReport)
+	}
+	if parallel.passCount != 5 || parallel.failCount != 3 || sequential.passCount != 5 || sequential.failCount != 3 {
+		t.Errorf("counts %d/%d parallel and %d/%d sequential, want 5 passed and 3 failed",
+			parallel.passCount, parallel.failCount, sequential.passCount, sequential.failCount)
+	}
+	if len(parallel.timings) != 8 {
+		t.Errorf("%d timings recorded, want 8", len(parallel.timings))
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/good.bas":      "PRINT ok",
+		"tests/expected/good.txt":   "ok\n",
+		"tests/basic/bad.bas":       "PRINT wrong",
+		"tests/expected/bad.txt":    "right\n",
+		"tests/errors/crash.bas":    "FAIL division by zero",
+		"tests/errors/no_error.bas": "PRINT fine",
+		"test_sample.bas":           "PRINT BASIC Interpreter Test\nPRINT Program completed successfully",
+	})
+	t.Chdir(filepath.Dir(filepath.Dir(bt.testsDir)))
+	captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.RunErrorTests()
+		bt.RunManualTests()
+	})
+
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := bt.WriteJUnit(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("report does not start with the XML header:\n%s", data)
+	}
+	var report junitSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report is not valid XML: %v\n%s", err, data)
+	}
+
+	if report.Tests != 5 || report.Failures != 2 || len(report.Suites) != 3 {
+		t.Fatalf("%d tests, %d failures in %d suites; want 5, 2 in 3:\n%s", report.Tests, report.Failures, len(report.Suites), data)
+	}
+	want := []struct {
+		name     string
+		cases    []string
+		failures map[string]string
+	}{
+		{"success", []string{"bad", "good"}, map[string]string{"bad": `output mismatch: expected "right\n", got "wrong\n"`}},
+		{"errors", []string{"crash", "no_error"}, map[string]string{"no_error": "should have failed but succeeded"}},
+		{"manual", []string{"test_sample"}, nil},
+	}
+	for i, suite := range report.Suites {
+		if suite.Name != want[i].name || suite.Tests != len(want[i].cases) || suite.Failures != len(want[i].failures) {
+			t.Errorf("suite %d is %s with %d tests and %d failures, want %s with %d and %d", i,
+				suite.Name, suite.Tests, suite.Failures, want[i].name, len(want[i].cases), len(want[i].failures))
+			continue
+		}
+		for j, c := range suite.Cases {
+			if c.Name != want[i].cases[j] || c.Classname != suite.Name || c.Time == "" {
+				t.Errorf("%s case %d is %+v, want %s", suite.Name, j, c, want[i].cases[j])
+			}
+			message, failed := want[i].failures[c.Name]
+			if (c.Failure != nil) != failed || failed && c.Failure.Message != message {
+				t.Errorf("%s/%s failure %+v, want %q", suite.Name, c.Name, c.Failure, message)
+			}
+		}
+	}
+}
+
+func TestInputFixtureFedToStdin(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/ask.bas":         "PRINT What is your name?\nECHOINPUT",
+		"tests/input/ask.txt":         "Ada\n42\n",
+		"tests/expected/ask.txt":      "What is your name?\nAda\n42\n",
+		"tests/basic/no_input.bas":    "ECHOINPUT\nPRINT done",
+		"tests/expected/no_input.txt": "done\n",
+	})
+	report := captureStdout(t, bt.RunSuccessTests)
+	if bt.passCount != 2 || bt.failCount != 0 {
+		t.Errorf("%d passed and %d failed, want both to pass:\n%s", bt.passCount, bt.failCount, report)
+	}
+
+	output, err := bt.RunBasicFile(filepath.Join(bt.testsDir, "ask.bas"))
+	if err != nil || output != "What is your name?\nAda\n42\n" {
+		t.Errorf("got %q, %v; want the input fixture echoed", output, err)
+	}
+}
+
+func TestExpectedErrorMessages(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/errors/match.bas":    "FAIL error at line 20: division by zero",
+		"tests/errors/match.err":    "division by zero\n",
+		"tests/errors/mismatch.bas": "FAIL panic: index out of range",
+		"tests/errors/mismatch.err": "division by zero\n",
+		"tests/errors/any.bas":      "FAIL anything at all",
+	})
+	report := captureStdout(t, bt.RunErrorTests)
+
+	if bt.passCount != 2 || bt.failCount != 1 {
+		t.Errorf("%d passed and %d failed, want only the mismatch to fail:\n%s", bt.passCount, bt.failCount, report)
+	}
+	for _, want := range []string{
+		"Running match... PASS (correctly failed)",
+		"Running mismatch... FAIL (wrong error message)",
+		`Expected error containing: "division by zero"`,
+		`Actual stderr:             "panic: index out of range\n"`,
+		"Running any... PASS (correctly failed)",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestOutputDiffMarksChangedLine(t *testing.T) {
+	expected := "1\n2\n3\n4\n5\n6\n7\n"
+	actual := "1\n2\n3\nFOUR\n5\n6\n7\n"
+
+	bt := newFakeTester(t, nil)
+	want := `    --- expected
+    +++ actual
+    @@ -2,5 +2,5 @@
+     2
+     3
+    -4
+    +FOUR
+     5
+     6
+`
+	if got := bt.outputDiff(expected, actual); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	bt.color = true
+	colored := bt.outputDiff(expected, actual)
+	for _, line := range []string{colorRed + "-4" + colorReset, colorGreen + "+FOUR" + colorReset, "     3\n"} {
+		if !strings.Contains(colored, line) {
+			t.Errorf("colored diff lacks %q:\n%q", line, colored)
+		}
+	}
+
+	bt = newFakeTester(t, map[string]string{
+		"tests/basic/count.bas":    "PRINT 1\nPRINT 2\nPRINT 3\nPRINT FOUR",
+		"tests/expected/count.txt": "1\n2\n3\n4\n",
+	})
+	report := captureStdout(t, bt.RunSuccessTests)
+	if !strings.Contains(report, "FAIL (output mismatch)\n    --- expected\n    +++ actual\n    @@ -2,3 +2,3 @@\n     2\n     3\n    -4\n    +FOUR\n") {
+		t.Errorf("report lacks the diff:\n%s", report)
+	}
+}
+
+func TestTrailingNewlineComparison(t *testing.T) {
+	for _, test := range []struct {
+		expected, actual string
+		loose, strict    bool
+	}{
+		{"hi\n", "hi\n", true, true},
+		{"hi", "hi\n", true, false},
+		{"hi\n", "hi", true, false},
+		{"hi\n\n", "hi", false, false},
+		{"hi\n", "ho\n", false, false},
+	} {
+		if got := outputsMatch(test.expected, test.actual, false); got != test.loose {
+			t.Errorf("outputsMatch(%q, %q) = %v, want %v", test.expected, test.actual, got, test.loose)
+		}
+		if got := outputsMatch(test.expected, test.actual, true); got != test.strict {
+			t.Errorf("strict outputsMatch(%q, %q) = %v, want %v", test.expected, test.actual, got, test.strict)
+		}
+	}
+
+	files := map[string]string{
+		"tests/basic/hello.bas":    "PRINT hello",
+		"tests/expected/hello.txt": "hello",
+	}
+	bt := newFakeTester(t, files)
+	captureStdout(t, bt.RunSuccessTests)
+	if bt.passCount != 1 {
+		t.Error("a missing final newline in the expected output failed the test")
+	}
+
+	bt = newFakeTester(t, files)
+	bt.strict = true
+	report := captureStdout(t, bt.RunSuccessTests)
+	if bt.failCount != 1 || !strings.Contains(report, `\ Expected output has no newline at the end`) {
+		t.Errorf("strict comparison did not fail on the final newline:\n%s", report)
+	}
+}
+
+func TestNestedTestDiscovery(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/top.bas":                  "PRINT top",
+		"tests/basic/loops/for.bas":            "PRINT for",
+		"tests/basic/loops/nested/deep.bas":    "PRINT deep",
+		"tests/basic/loops/notes.txt":          "not a test",
+		"tests/expected/top.txt":               "top\n",
+		"tests/expected/loops/for.txt":         "for\n",
+		"tests/expected/loops/nested/deep.txt": "deep\n",
+		"tests/errors/syntax/bad.bas":          "FAIL bad",
+	})
+
+	files, err := bt.GetBasicFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, bt.GetTestName(file))
+	}
+	if got, want := strings.Join(names, " "), "loops/for loops/nested/deep top"; got != want {
+		t.Errorf("discovered %q, want %q", got, want)
+	}
+
+	errorFiles, err := bt.GetErrorFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errorFiles) != 1 || bt.GetTestName(errorFiles[0]) != "syntax/bad" {
+		t.Errorf("discovered error tests %q", errorFiles)
+	}
+
+	report := captureStdout(t, bt.RunSuccessTests)
+	if bt.passCount != 3 || bt.failCount != 0 {
+		t.Errorf("nested tests did not find their expected output:\n%s", report)
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/loops/for.bas":    "PRINT for",
+		"tests/basic/LoopWhile.bas":    "PRINT while",
+		"tests/basic/strings.bas":      "FAIL should not run",
+		"tests/expected/loops/for.txt": "for\n",
+		"tests/expected/LoopWhile.txt": "while\n",
+		"tests/errors/loop_bad.bas":    "FAIL bad",
+		"tests/errors/other.bas":       "PRINT should not run",
+	})
+	bt.runFilter = "LOOP"
+
+	report := captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.RunErrorTests()
+		bt.PrintSummary()
+	})
+	if bt.passCount != 3 || bt.failCount != 0 {
+		t.Errorf("passed %d, failed %d, want 3 and 0:\n%s", bt.passCount, bt.failCount, report)
+	}
+	for _, name := range []string{"strings", "other"} {
+		if strings.Contains(report, "Running "+name) {
+			t.Errorf("%s ran despite the filter:\n%s", name, report)
+		}
+	}
+	if !strings.Contains(report, "Skipped by -run LOOP: 2") {
+		t.Errorf("summary does not count the filtered tests:\n%s", report)
+	}
+
+	bt = newFakeTester(t, map[string]string{"tests/basic/strings.bas": "PRINT s"})
+	bt.runFilter = "loop"
+	report = captureStdout(t, bt.RunSuccessTests)
+	if !strings.Contains(report, "No success tests match -run loop") {
+		t.Errorf("no message when nothing matches:\n%s", report)
+	}
+}
+
+func TestTimingsRecordedAndSorted(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/a.bas":    "SLEEP 60\nPRINT a",
+		"tests/basic/b.bas":    "PRINT b",
+		"tests/basic/c.bas":    "SLEEP 120\nPRINT c",
+		"tests/expected/a.txt": "a\n",
+		"tests/expected/b.txt": "b\n",
+		"tests/expected/c.txt": "c\n",
+	})
+	bt.showTimings = true
+	report := captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.PrintSummary()
+	})
+
+	if len(bt.timings) != 3 {
+		t.Fatalf("recorded %d timings, want 3", len(bt.timings))
+	}
+	for _, timing := range bt.timings {
+		if timing.duration <= 0 {
+			t.Errorf("%s has no duration", timing.name)
+		}
+	}
+	slowest := bt.SlowestTests(10)
+	if len(slowest) != 3 || slowest[0].name != "c" || slowest[1].name != "a" {
+		t.Errorf("slowest tests = %v, want c and a first", slowest)
+	}
+	for i := 1; i < len(slowest); i++ {
+		if slowest[i].duration > slowest[i-1].duration {
+			t.Errorf("slowest tests not sorted descending: %v", slowest)
+		}
+	}
+	if top := bt.SlowestTests(1); len(top) != 1 || top[0].name != "c" {
+		t.Errorf("SlowestTests(1) = %v", top)
+	}
+
+	if !strings.Contains(report, "over 3 run(s)") || !strings.Contains(report, " 1. c ") {
+		t.Errorf("summary does not list the timings:\n%s", report)
+	}
+}
+
+func TestTAPReport(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/good.bas":    "PRINT ok",
+		"tests/expected/good.txt": "ok\n",
+		"tests/basic/bad.bas":     "PRINT wrong",
+		"tests/expected/bad.txt":  "right\n",
+		"tests/errors/crash.bas":  "FAIL division by zero",
+		"test_sample.bas":         "PRINT BASIC Interpreter Test\nPRINT Program completed successfully",
+	})
+	t.Chdir(filepath.Dir(filepath.Dir(bt.testsDir)))
+	captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.RunErrorTests()
+		bt.RunManualTests()
+	})
+
+	var sb strings.Builder
+	if err := bt.WriteTAP(&sb); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	if len(lines) < 2 || lines[0] != "TAP version 13" || lines[1] != "1..4" {
+		t.Fatalf("TAP header is not a version line and a plan of 4:\n%s", sb.String())
+	}
+
+	var results []string
+	for _, line := range lines[2:] {
+		if strings.HasPrefix(line, "ok ") || strings.HasPrefix(line, "not ok ") {
+			results = append(results, line)
+		}
+	}
+	want := []string{
+		"not ok 1 - success/bad",
+		"ok 2 - success/good",
+		"ok 3 - errors/crash",
+		"ok 4 - manual/test_sample",
+	}
+	if strings.Join(results, "\n") != strings.Join(want, "\n") {
+		t.Errorf("test lines:\n%s\nwant:\n%s", strings.Join(results, "\n"), strings.Join(want, "\n"))
+	}
+
+	_, diagnostics, _ := strings.Cut(sb.String(), "not ok 1 - success/bad\n")
+	diagnostics, _, _ = strings.Cut(diagnostics, "ok 2")
+	for _, want := range []string{
+		"  ---\n",
+		`  message: "output mismatch: expected \"right\\n\", got \"wrong\\n\""` + "\n",
+		"  severity: fail\n",
+		"  suite: success\n",
+		"  duration_ms: ",
+		"  ...\n",
+	} {
+		if !strings.Contains(diagnostics, want) {
+			t.Errorf("failure diagnostics lack %q:\n%s", want, diagnostics)
+		}
+	}
+}
+
+func TestReportGoesToOut(t *testing.T) {
+	bt := newFakeTester(t, map[string]string{
+		"tests/basic/good.bas":    "PRINT ok",
+		"tests/expected/good.txt": "ok\n",
+	})
+	var report strings.Builder
+	bt.out = &report
+	stdout := captureStdout(t, func() {
+		bt.RunSuccessTests()
+		bt.PrintSummary()
+	})
+	if stdout != "" {
+		t.Errorf("report written to stdout:\n%s", stdout)
+	}
+	if !strings.Contains(report.String(), "Running good... ") || !strings.Contains(report.String(), "Passed: 1") {
+		t.Errorf("report not written to out:\n%s", report.String())
+	}
+
+	// With -tap, stdout carries only TAP and the report goes to stderr
+	args := []string{"-tap", "-skip-manual"}
+	for _, arg := range fakeArgs {
+		args = append(args, "-arg", arg)
+	}
+	args = append(args, "-env", "BASIC_FAKE_INTERPRETER=1", os.Args[0])
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunnerHelper$")
+	cmd.Dir = filepath.Dir(filepath.Dir(bt.testsDir))
+	cmd.Env = append(os.Environ(), "BASIC_TEST_RUNNER=1", "BASIC_TEST_RUNNER_ARGS="+strings.Join(args, "\n"))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	if want := "TAP version 13\n1..1\nok 1 - success/good\n"; string(output) != want {
+		t.Errorf("stdout = %q, want only TAP", output)
+	}
+	if !strings.Contains(stderr.String(), "Passed: 1") {
+		t.Errorf("report not on stderr:\n%s", stderr.String())
+	}
+}